@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.com/zaker/anachrome-be/config"
+	"github.com/zaker/anachrome-be/stores/dropbox"
+)
+
+var dropboxCmd = &cobra.Command{
+	Use:   "dropbox",
+	Short: "manage the dropbox blog store",
+	Long:  `manage the dropbox blog store`,
+}
+
+var dropboxTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "create the metadata property template",
+	Long: `create the property template post metadata is synced to, and print its ID.
+Set DROPBOX_TEMPLATE_ID to the ID to use it.`,
+	RunE: runDropboxTemplate,
+}
+
+var dropboxAuthCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "authorize the app and print a refresh token",
+	Long: `authorize the app with DROPBOX_APP_KEY using the PKCE code flow, and print a refresh token.
+Set DROPBOX_REFRESH_TOKEN to the token to use it.`,
+	RunE: runDropboxAuth,
+}
+
+func runDropboxAuth(cmd *cobra.Command, args []string) error {
+
+	appKey := config.DropboxAppKey()
+	if len(appKey) == 0 {
+		return fmt.Errorf("DROPBOX_APP_KEY is not set")
+	}
+	verifier, challenge, err := dropbox.NewPKCEVerifier()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.ErrOrStderr(), "Open this URL, allow access and paste the code:")
+	fmt.Fprintln(cmd.ErrOrStderr(), dropbox.AuthorizeURL(appKey, challenge))
+	var code string
+	_, err = fmt.Fscanln(cmd.InOrStdin(), &code)
+	if err != nil {
+		return fmt.Errorf("reading code: %w", err)
+	}
+
+	c := dropbox.NewClient(&http.Client{}, "", "", "", dropboxClientOptions()...)
+	refreshToken, err := c.ExchangeCode(context.Background(), appKey, code, verifier)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), refreshToken)
+	return nil
+}
+
+func runDropboxTemplate(cmd *cobra.Command, args []string) error {
+
+	c := dropbox.NewClient(
+		&http.Client{},
+		config.DropboxKey(),
+		config.DropboxFolder(),
+		"",
+		dropboxClientOptions()...)
+	id, err := c.AddPropertyTemplate(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), id)
+	return nil
+}
+
+func init() {
+	dropboxCmd.AddCommand(dropboxTemplateCmd)
+	dropboxCmd.AddCommand(dropboxAuthCmd)
+	rootCmd.AddCommand(dropboxCmd)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zaker/anachrome-be/config"
+)
+
+var (
+	healthcheckReady   bool
+	healthcheckTimeout time.Duration
+)
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "probe the health of the server",
+	Long: `probe /healthz of the server listening on HTTP_PORT, or /readyz with --ready,
+and exit with an error unless it is healthy. The image has no shell or curl,
+so its HEALTHCHECK runs this.`,
+	Args:         cobra.NoArgs,
+	RunE:         runHealthcheck,
+	SilenceUsage: true,
+}
+
+func runHealthcheck(cmd *cobra.Command, args []string) error {
+
+	port := config.HTTPPort()
+	if port == 0 {
+		port = 8080
+	}
+	endpoint := "/healthz"
+	if healthcheckReady {
+		endpoint = "/readyz"
+	}
+
+	client := &http.Client{Timeout: healthcheckTimeout}
+	resp, err := client.Get("http://127.0.0.1:" + strconv.Itoa(port) + endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	cmd.OutOrStdout().Write(body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+func init() {
+	healthcheckCmd.Flags().BoolVar(&healthcheckReady, "ready", false, "probe readiness instead of liveness")
+	healthcheckCmd.Flags().DurationVar(&healthcheckTimeout, "timeout", 10*time.Second, "how long to wait for the answer")
+	rootCmd.AddCommand(healthcheckCmd)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zaker/anachrome-be/config"
+	"github.com/zaker/anachrome-be/services"
+)
+
+var previewTTL time.Duration
+
+var previewCmd = &cobra.Command{
+	Use:   "preview <id>",
+	Short: "print a signed link to preview a post",
+	Long: `print a link signed with PREVIEW_SECRET that shows the post with the id,
+also when it is a draft or scheduled, until the link expires.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPreview,
+}
+
+func runPreview(cmd *cobra.Command, args []string) error {
+
+	if len(config.PreviewSecret()) == 0 {
+		return fmt.Errorf("PREVIEW_SECRET is not set")
+	}
+	signer := services.NewPreviewSigner(config.PreviewSecret())
+	fmt.Fprintln(cmd.OutOrStdout(), signer.URL(config.HostName(), args[0], time.Now().Add(previewTTL)))
+	return nil
+}
+
+func init() {
+	previewCmd.Flags().DurationVar(&previewTTL, "ttl", 7*24*time.Hour, "how long the link is valid")
+	rootCmd.AddCommand(previewCmd)
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zaker/anachrome-be/config"
+	"github.com/zaker/anachrome-be/middleware"
 )
 
 var cfgFile string
@@ -19,7 +22,7 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatal("root.Execute", "", err)
+		slog.Error("executing command", slog.Any("err", err))
 		os.Exit(1)
 	}
 }
@@ -43,7 +46,35 @@ func initConfig() {
 		viper.SetConfigName(".anachrome")
 	}
 	viper.AutomaticEnv()
-	if err := viper.ReadInConfig(); err == nil {
-		log.Println("Using config file")
+	err := viper.ReadInConfig()
+	initLogging()
+	if err == nil {
+		slog.Info("using config file", slog.String("file", viper.ConfigFileUsed()))
 	}
 }
+
+// initLogging logs at LOG_LEVEL in LOG_FORMAT to stderr, adding the request and trace IDs of the context.
+// Packages logging with the standard log package end up here too.
+func initLogging() {
+
+	var level slog.Level
+	if len(config.LogLevel()) > 0 {
+		if err := level.UnmarshalText([]byte(config.LogLevel())); err != nil {
+			slog.Error("invalid LOG_LEVEL", slog.Any("err", err))
+			os.Exit(1)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.LogFormat()) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		slog.Error("invalid LOG_FORMAT, use text or json", slog.String("format", config.LogFormat()))
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(middleware.ContextHandler(handler)))
+}
@@ -3,8 +3,13 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/zaker/anachrome-be/stores/cache"
 
@@ -12,7 +17,9 @@ import (
 	"github.com/spf13/viper"
 	"github.com/zaker/anachrome-be/config"
 	"github.com/zaker/anachrome-be/servers"
+	"github.com/zaker/anachrome-be/services"
 	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/dropbox"
 )
 
 var serveCmd = &cobra.Command{
@@ -22,7 +29,58 @@ var serveCmd = &cobra.Command{
 	Run:   runServe,
 }
 
-func createHTTPServerOptions() ([]servers.Option, error) {
+func createBlogStore() (blog.BlogStore, <-chan string, error) {
+
+	switch config.BlogStore() {
+	case "", "dropbox":
+		dbxBlog := blog.NewDropboxBlogStore(
+			&http.Client{},
+			config.DropboxKey(),
+			config.DropboxFolder(),
+			config.DropboxTemplateID(),
+			dropboxClientOptions()...)
+		return dbxBlog, dbxBlog.UpdatesChan, nil
+	case "local":
+		localBlog, err := blog.NewLocalBlogStore(config.BlogDir())
+		if err != nil {
+			return nil, nil, err
+		}
+		return localBlog, localBlog.UpdatesChan, nil
+	case "git":
+		gitBlog, err := blog.NewGitBlogStore(
+			config.BlogGitRepo(),
+			config.BlogGitBranch(),
+			config.BlogGitPath(),
+			config.BlogGitPollInterval())
+		if err != nil {
+			return nil, nil, err
+		}
+		return gitBlog, gitBlog.UpdatesChan, nil
+	}
+	return nil, nil, fmt.Errorf("unknown blog store %q", config.BlogStore())
+}
+
+func dropboxClientOptions() []dropbox.ClientOption {
+	var opts []dropbox.ClientOption
+	if len(config.DropboxAPIURL()) > 0 {
+		opts = append(opts, dropbox.WithAPIURL(config.DropboxAPIURL()))
+	}
+	if len(config.DropboxContentURL()) > 0 {
+		opts = append(opts, dropbox.WithContentURL(config.DropboxContentURL()))
+	}
+	if len(config.DropboxNotifyURL()) > 0 {
+		opts = append(opts, dropbox.WithNotifyURL(config.DropboxNotifyURL()))
+	}
+	if len(config.DropboxRefreshToken()) > 0 {
+		opts = append(opts, dropbox.WithRefreshToken(
+			config.DropboxAppKey(),
+			config.DropboxAppSecret(),
+			config.DropboxRefreshToken()))
+	}
+	return opts
+}
+
+func createHTTPServerOptions(ctx context.Context) ([]servers.Option, error) {
 	opts := []servers.Option{servers.WithAPIVersion(config.Version)}
 
 	if len(config.HostName()) > 0 {
@@ -37,23 +95,60 @@ func createHTTPServerOptions() ([]servers.Option, error) {
 		return opts, fmt.Errorf("cannot create server without hostname")
 	}
 
-	dbxBlog := blog.NewDropboxBlogStore(
-		&http.Client{},
-		config.DropboxKey(),
-		"/blog",
-		"ptid:vjStHN01QQQAAAAAAABF4g")
+	blogStore, updates, err := createBlogStore()
+	if err != nil {
+		return opts, err
+	}
+	assetStore, ok := blogStore.(blog.AssetStore)
+	if ok {
+		opts = append(opts, servers.WithAssets(assetStore))
+	}
+	if dbxBlog, ok := blogStore.(*blog.DropboxBlog); ok {
+		opts = append(
+			opts,
+			servers.WithSyncer(dbxBlog),
+			servers.WithHealthCheck("dropbox_token", dbxBlog.CheckToken),
+			servers.WithHealthCheck("dropbox_listed", dbxBlog.CheckListed))
+		if len(config.DropboxAppSecret()) > 0 {
+			opts = append(
+				opts,
+				servers.WithDropboxWebhook(servers.DropboxWebhookConfig{
+					AppSecret: config.DropboxAppSecret(),
+					Syncer:    dbxBlog,
+				}))
+		}
+	}
+
+	// Drafts and scheduled posts are only shown through signed preview links
+	drafts := blogStore
+	if len(config.PreviewSecret()) > 0 {
+		opts = append(opts, servers.WithPreviews(drafts, config.PreviewSecret()))
+	}
+	opts = append(opts, servers.WithMetrics(blog.PendingUpdates(updates)))
+	updates = blog.NewPublishScheduler(ctx, drafts, updates).UpdatesChan
+	blogStore = blog.NewPublishedBlogStore(drafts)
+
+	markdown, err := services.NewMarkdown(config.HighlightStyle())
+	if err != nil {
+		return opts, err
+	}
+	if assetStore != nil {
+		markdown.SizeImages(assetStore)
+	}
+	blogStore = services.NewRenderedBlogStore(blogStore, markdown, config.HostName())
 
 	var bs cache.CachedBlogStore
 	if len(config.RedisHost()) > 0 {
-		cachedBlogStore, err := cache.NewRedisBlogCache(dbxBlog, config.RedisHost())
+		cachedBlogStore, err := cache.NewRedisBlogCache(blogStore, config.RedisHost())
 
 		if err != nil {
 			return opts, err
 		}
 		bs = cachedBlogStore
+		opts = append(opts, servers.WithHealthCheck("redis", cachedBlogStore.Ping))
 
 	} else {
-		cachedBlogStore, err := cache.NewInMemoryCache(dbxBlog)
+		cachedBlogStore, err := cache.NewInMemoryCache(blogStore)
 		if err != nil {
 			return opts, err
 		}
@@ -61,23 +156,43 @@ func createHTTPServerOptions() ([]servers.Option, error) {
 
 	}
 
-	go func() {
-		for id := range dbxBlog.UpdatesChan {
-			err := bs.Invalidate(context.Background(), id)
-			if err != nil {
-				log.Println("warn: invalidating", err)
-			}
-		}
-	}()
+	if images, ok := bs.(cache.BlobCache); ok {
+		opts = append(opts, servers.WithImageCache(images))
+	}
 
 	opts = append(
 		opts,
-		servers.WithBlogStore(bs))
+		servers.WithBlogStore(bs),
+		servers.WithUpdates(updates),
+		servers.WithMarkdown(markdown),
+		servers.WithRobots(config.RobotsTxt()))
+
+	opts = append(
+		opts,
+		servers.WithFeed(servers.FeedConfig{
+			Title: config.FeedTitle(),
+			Limit: config.FeedLimit(),
+		}))
 
 	opts = append(
 		opts,
 		servers.WithGQL())
 
+	if len(config.AuthServer()) > 0 || len(config.ApiSecret()) > 0 {
+		oauth2 := servers.OAuth2Option{
+			Audience:  config.AuthAudience(),
+			Issuer:    config.AuthIssuer(),
+			ApiSecret: []byte(config.ApiSecret()),
+		}
+		if len(config.AuthServer()) > 0 {
+			oauth2.AuthServer, err = url.Parse(config.AuthServer())
+			if err != nil {
+				return opts, fmt.Errorf("parsing auth server: %w", err)
+			}
+		}
+		opts = append(opts, servers.WithOAuth2(oauth2))
+	}
+
 	if config.RunDevMode() {
 		opts = append(
 			opts,
@@ -105,22 +220,42 @@ func serve(opts []servers.Option) error {
 func runServe(cmd *cobra.Command, args []string) {
 
 	if viper.ConfigFileUsed() == "" {
-		log.Println("Config from environment variables")
+		slog.Info("config from environment variables")
 	}
 
-	opts, err := createHTTPServerOptions()
-	if err != nil {
-		log.Fatal("Creating http server options", err)
+	if len(config.OTLPEndpoint()) > 0 {
+		shutdown, err := services.InitTracing(context.Background(), config.OTLPEndpoint(), config.Version)
+		if err != nil {
+			fatal("initializing tracing", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				slog.Warn("flushing traces", slog.Any("err", err))
+			}
+		}()
+	}
 
+	// Background work of the stores stops when the server is shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	opts, err := createHTTPServerOptions(ctx)
+	if err != nil {
+		fatal("creating http server options", err)
 	}
 
 	err = serve(opts)
 	if err != nil {
-		log.Fatal("Error starting http server", err)
-
+		fatal("running http server", err)
 	}
 }
 
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("err", err))
+	os.Exit(1)
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 }
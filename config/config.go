@@ -1,6 +1,10 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 //Version Api version
 var Version string
@@ -25,6 +29,89 @@ func DropboxKey() string {
 	return viper.GetString("DROPBOX_KEY")
 }
 
+//DropboxAppKey app key used to refresh access tokens and authorize the app
+func DropboxAppKey() string {
+	return viper.GetString("DROPBOX_APP_KEY")
+}
+
+//DropboxRefreshToken long-lived token access tokens are refreshed from, replaces DROPBOX_KEY
+func DropboxRefreshToken() string {
+	return viper.GetString("DROPBOX_REFRESH_TOKEN")
+}
+
+//DropboxFolder folder in Dropbox holding the posts, /blog when unset
+func DropboxFolder() string {
+	return viper.GetString("DROPBOX_FOLDER")
+}
+
+//DropboxTemplateID property template the post metadata is synced to
+func DropboxTemplateID() string {
+	if id := viper.GetString("DROPBOX_TEMPLATE_ID"); len(id) > 0 {
+		return id
+	}
+	return "ptid:vjStHN01QQQAAAAAAABF4g"
+}
+
+//DropboxAPIURL base URL of the Dropbox RPC endpoints, for running against a fake Dropbox
+func DropboxAPIURL() string {
+	return viper.GetString("DROPBOX_API_URL")
+}
+
+//DropboxContentURL base URL of the Dropbox content endpoints
+func DropboxContentURL() string {
+	return viper.GetString("DROPBOX_CONTENT_URL")
+}
+
+//DropboxNotifyURL base URL of the Dropbox longpoll endpoint
+func DropboxNotifyURL() string {
+	return viper.GetString("DROPBOX_NOTIFY_URL")
+}
+
+//DropboxAppSecret app secret signing Dropbox webhook notifications
+func DropboxAppSecret() string {
+	return viper.GetString("DROPBOX_APP_SECRET")
+}
+
+//PreviewSecret signs links to previews of drafts and scheduled posts, previews are off when unset
+func PreviewSecret() string {
+	return viper.GetString("PREVIEW_SECRET")
+}
+
+//AuthServer OAuth2 server publishing the keys of admin API tokens at /.well-known/jwks.json
+func AuthServer() string {
+	return viper.GetString("AUTH_SERVER")
+}
+
+//AuthAudience audience admin API tokens must be issued for, required with AUTH_SERVER
+func AuthAudience() string {
+	return viper.GetString("AUTH_AUDIENCE")
+}
+
+//AuthIssuer issuer of admin API tokens, required with AUTH_SERVER
+func AuthIssuer() string {
+	return viper.GetString("AUTH_ISSUER")
+}
+
+//ApiSecret verifies HS256 admin API tokens
+func ApiSecret() string {
+	return viper.GetString("API_SECRET")
+}
+
+//OTLPEndpoint base URL of an OTLP/HTTP collector receiving traces at /v1/traces, tracing is off when unset
+func OTLPEndpoint() string {
+	return viper.GetString("OTLP_ENDPOINT")
+}
+
+//LogLevel lowest level logged, debug, info (default), warn or error
+func LogLevel() string {
+	return viper.GetString("LOG_LEVEL")
+}
+
+//LogFormat format of log records, text (default) or json
+func LogFormat() string {
+	return viper.GetString("LOG_FORMAT")
+}
+
 func RedisHost() string {
 	return viper.GetString("REDIS_HOST")
 }
@@ -32,3 +119,53 @@ func RedisHost() string {
 func RedisPassword() string {
 	return viper.GetString("REDIS_PASSWORD")
 }
+
+//BlogStore backend serving blog posts, dropbox (default), local or git
+func BlogStore() string {
+	return viper.GetString("BLOG_STORE")
+}
+
+//BlogDir directory of markdown files for the local blog store
+func BlogDir() string {
+	return viper.GetString("BLOG_DIR")
+}
+
+//BlogGitRepo path to the bare or working git repository for the git blog store
+func BlogGitRepo() string {
+	return viper.GetString("BLOG_GIT_REPO")
+}
+
+//BlogGitBranch branch the git blog store reads posts from
+func BlogGitBranch() string {
+	return viper.GetString("BLOG_GIT_BRANCH")
+}
+
+//BlogGitPath directory in the git repository holding the posts
+func BlogGitPath() string {
+	return viper.GetString("BLOG_GIT_PATH")
+}
+
+//BlogGitPollInterval how often the git blog store looks for new commits
+func BlogGitPollInterval() time.Duration {
+	return viper.GetDuration("BLOG_GIT_POLL_INTERVAL")
+}
+
+//HighlightStyle chroma style used for the code highlighting stylesheet
+func HighlightStyle() string {
+	return viper.GetString("HIGHLIGHT_STYLE")
+}
+
+//FeedTitle title of the atom, rss and json feeds
+func FeedTitle() string {
+	return viper.GetString("FEED_TITLE")
+}
+
+//FeedLimit maximum number of posts in the feeds
+func FeedLimit() int {
+	return viper.GetInt("FEED_LIMIT")
+}
+
+//RobotsTxt rules served in robots.txt, the sitemap location is appended
+func RobotsTxt() string {
+	return viper.GetString("ROBOTS_TXT")
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/zaker/anachrome-be/middleware"
+	"github.com/zaker/anachrome-be/stores/cache"
+)
+
+type Admin struct {
+	cache      cache.CachedBlogStore
+	invalidate func(context.Context, string) error
+	resync     func(context.Context) error
+}
+
+// NewAdmin manages the cache of the blog store. Invalidate tells the cache and the
+// caches derived from it about a changed post, resync rebuilds all of them.
+func NewAdmin(cache cache.CachedBlogStore, invalidate func(context.Context, string) error, resync func(context.Context) error) *Admin {
+	return &Admin{cache, invalidate, resync}
+}
+
+type tokenInfo struct {
+	Subject string   `json:"subject"`
+	Scopes  []string `json:"scopes"`
+}
+
+// WhoAmI shows the subject and scopes of the token, to check tokens against the admin API
+func (a *Admin) WhoAmI(c *echo.Context) error {
+
+	claims, ok := middleware.TokenClaims(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, "bearer token required")
+	}
+	return c.JSON(http.StatusOK, tokenInfo{Subject: claims.Subject, Scopes: claims.Scopes()})
+}
+
+type cacheEntry struct {
+	cache.Entry
+	// Age is the number of seconds since the entry was stored
+	Age int64 `json:"age"`
+}
+
+// CacheEntries lists the cached keys with their size and age
+func (a *Admin) CacheEntries(c *echo.Context) error {
+
+	entries, err := a.cache.Entries(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	listed := make([]cacheEntry, 0, len(entries))
+	for _, ent := range entries {
+		listed = append(listed, cacheEntry{Entry: ent, Age: int64(now.Sub(ent.Stored).Seconds())})
+	}
+	return c.JSON(http.StatusOK, listed)
+}
+
+// InvalidatePost drops the post in the path from the caches
+func (a *Admin) InvalidatePost(c *echo.Context) error {
+
+	err := a.invalidate(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// FlushCache empties the blog store cache
+func (a *Admin) FlushCache(c *echo.Context) error {
+
+	err := a.cache.Flush(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Resync empties the caches and reads everything from the backing store again.
+// Stores syncing in the background may send updates after the response.
+func (a *Admin) Resync(c *echo.Context) error {
+
+	err := a.resync(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/middleware"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/cache"
+)
+
+func TestAdmin(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id}, Content: "Content of " + id}, nil
+		},
+	}
+	c, err := cache.NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var invalidated []string
+	resyncs := 0
+	a := NewAdmin(c,
+		func(ctx context.Context, id string) error {
+			invalidated = append(invalidated, id)
+			return c.Invalidate(ctx, id)
+		},
+		func(ctx context.Context) error {
+			resyncs++
+			return c.Flush(ctx)
+		})
+
+	secret := []byte("secret")
+	e := echo.New()
+	admin := e.Group("/admin", middleware.JWT(middleware.JWTConfig{Secret: secret}))
+	admin.GET("/whoami", a.WhoAmI)
+	admin.GET("/cache", a.CacheEntries)
+	admin.DELETE("/cache", a.FlushCache)
+	admin.DELETE("/cache/posts/:id", a.InvalidatePost)
+	admin.POST("/resync", a.Resync)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "admin",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "cache:read cache:write",
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	cachedKeys := func() []string {
+		rec := request(http.MethodGet, "/admin/cache")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var entries []struct {
+			Key  string `json:"key"`
+			Size int    `json:"size"`
+			Age  int64  `json:"age"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		keys := []string{}
+		for _, ent := range entries {
+			keys = append(keys, ent.Key)
+		}
+		return keys
+	}
+
+	rec := request(http.MethodGet, "/admin/whoami")
+	assert.JSONEq(t, `{"subject":"admin","scopes":["cache:read","cache:write"]}`, rec.Body.String())
+
+	ctx := context.Background()
+	for _, id := range []string{"foo", "bar"} {
+		_, err = c.GetBlogPost(ctx, id)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"post:bar", "post:foo"}, cachedKeys())
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/admin/cache/posts/foo").Code)
+	assert.Equal(t, []string{"foo"}, invalidated)
+	assert.Equal(t, []string{"post:bar"}, cachedKeys())
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodDelete, "/admin/cache").Code)
+	assert.Equal(t, []string{}, cachedKeys())
+
+	_, err = c.GetBlogPost(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/admin/resync").Code)
+	assert.Equal(t, 1, resyncs)
+	assert.Equal(t, []string{}, cachedKeys())
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/labstack/echo/v5"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/cache"
+)
+
+// assetMaxAge is how long clients may cache assets before revalidating, authors rarely replace them
+const assetMaxAge = 30 * 24 * 60 * 60
+
+// maxImageBytes is the largest source image that is decoded for resizing
+const maxImageBytes = 32 << 20
+
+type Asset struct {
+	assets blog.AssetStore
+	images cache.BlobCache
+}
+
+// NewAsset serves assets, keeping resized images in the images cache when it is not nil
+func NewAsset(assets blog.AssetStore, images cache.BlobCache) *Asset {
+	return &Asset{assets, images}
+}
+
+// GetAsset streams a file that a post links to. Names are relative to the post,
+// which lives in the folder with the others. Images are resized by the w, h and fit
+// query parameters, converted to a format the client accepts and stripped of metadata.
+func (a *Asset) GetAsset(c *echo.Context) error {
+
+	name := c.Param("*")
+	if !blog.ValidAssetName(name) {
+		return c.JSON(http.StatusNotFound, name)
+	}
+	sourceFormat, isImage := services.ImageFormat(name)
+	var opts services.ImageOptions
+	if isImage {
+		var err error
+		opts, err = services.ParseImageOptions(c.QueryParams())
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		opts.Format = services.NegotiateImageFormat(c.Request().Header.Get(echo.HeaderAccept), sourceFormat)
+	}
+
+	asset, err := a.assets.GetAsset(c.Request().Context(), name)
+	if errors.Is(err, blog.ErrAssetNotFound) {
+		return c.JSON(http.StatusNotFound, name)
+	}
+	if err != nil {
+		return err
+	}
+	defer asset.Content.Close()
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderCacheControl, "public, max-age="+strconv.Itoa(assetMaxAge))
+	if isImage {
+		h.Add(echo.HeaderVary, echo.HeaderAccept)
+		// JPEGs are always rewritten to drop EXIF, other images only when they change
+		if opts.Resizes() || opts.Format != sourceFormat || sourceFormat == services.ImageJPEG {
+			return a.transformImage(c, asset, sourceFormat, opts)
+		}
+	}
+	if notModified(c, weakTag(asset.ContentHash), asset.Modified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if len(contentType) == 0 {
+		contentType = echo.MIMEOctetStream
+	}
+	h.Set("X-Content-Type-Options", "nosniff")
+	if asset.Size > 0 {
+		h.Set(echo.HeaderContentLength, strconv.FormatInt(asset.Size, 10))
+	}
+	return c.Stream(http.StatusOK, contentType, asset.Content)
+}
+
+// transformImage serves the image derived from the asset, from the image cache when it was derived before
+func (a *Asset) transformImage(c *echo.Context, asset blog.Asset, sourceFormat string, opts services.ImageOptions) error {
+
+	key := "image:" + asset.ContentHash + ":" + opts.Key()
+	if notModified(c, weakETag([]byte(key)), asset.Modified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	ctx := c.Request().Context()
+	var img []byte
+	if a.images != nil {
+		img, _ = a.images.GetBlob(ctx, key)
+	}
+	if img == nil {
+		src, err := io.ReadAll(io.LimitReader(asset.Content, maxImageBytes+1))
+		if err != nil {
+			return fmt.Errorf("reading image %s: %w", asset.Name, err)
+		}
+		if len(src) > maxImageBytes {
+			return c.JSON(http.StatusRequestEntityTooLarge, asset.Name)
+		}
+		img, err = services.TransformImage(src, sourceFormat, opts)
+		if errors.Is(err, services.ErrImageTooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, err.Error())
+		}
+		if a.images != nil {
+			if err := a.images.SetBlob(ctx, key, img); err != nil {
+				c.Logger().WarnContext(c.Request().Context(), "caching image", slog.String("key", key), slog.Any("err", err))
+			}
+		}
+	}
+
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Blob(http.StatusOK, opts.Format, img)
+}
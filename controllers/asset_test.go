@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+type fakeAssets map[string]string
+
+func (fa fakeAssets) GetAsset(ctx context.Context, name string) (blog.Asset, error) {
+	content, ok := fa[name]
+	if !ok {
+		return blog.Asset{}, blog.ErrAssetNotFound
+	}
+	return blog.Asset{
+		Name:        name,
+		ContentHash: "hash-" + name,
+		Size:        int64(len(content)),
+		Modified:    time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC),
+		Content:     io.NopCloser(strings.NewReader(content)),
+	}, nil
+}
+
+func TestGetAsset(t *testing.T) {
+
+	// Like Dropbox, the store would serve the markdown of a post under any case
+	a := NewAsset(fakeAssets{"img/cat.png": "PNG", "notes": "text", "draft.MD": "---\ndraft: true\n---\n"}, nil)
+	e := echo.New()
+	e.GET("/blog/:id/assets/*", a.GetAsset)
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/blog/foo/assets/img/cat.png", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "PNG", rec.Body.String())
+	assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, `W/"hash-img/cat.png"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "public, max-age=2592000", rec.Header().Get(echo.HeaderCacheControl))
+
+	rec = get("/blog/foo/assets/img/cat.png", http.Header{"If-None-Match": {`"hash-img/cat.png"`}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = get("/blog/foo/assets/notes", nil)
+	assert.Equal(t, echo.MIMEOctetStream, rec.Header().Get(echo.HeaderContentType))
+
+	for _, target := range []string{"/blog/foo/assets/dog.png", "/blog/foo/assets/foo.md", "/blog/foo/assets/draft.MD", "/blog/foo/assets/img/../../cat.png"} {
+		assert.Equal(t, http.StatusNotFound, get(target, nil).Code, target)
+	}
+}
+
+type fakeBlobs map[string][]byte
+
+func (fb fakeBlobs) GetBlob(ctx context.Context, key string) ([]byte, bool) {
+	b, ok := fb[key]
+	return b, ok
+}
+
+func (fb fakeBlobs) SetBlob(ctx context.Context, key string, b []byte) error {
+	fb[key] = b
+	return nil
+}
+
+func TestGetAsset_Image(t *testing.T) {
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	b := bytes.Buffer{}
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	assets := fakeAssets{"cat.png": b.String()}
+	images := fakeBlobs{}
+	a := NewAsset(assets, images)
+	e := echo.New()
+	e.GET("/blog/:id/assets/*", a.GetAsset)
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/blog/foo/assets/cat.png?w=10", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, echo.HeaderAccept, rec.Header().Get(echo.HeaderVary))
+	cfg, err := png.DecodeConfig(rec.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, cfg.Width)
+	assert.Equal(t, 5, cfg.Height)
+	assert.Len(t, images, 1)
+	etag := rec.Header().Get("ETag")
+	assert.NotEqual(t, `W/"hash-cat.png"`, etag)
+
+	rec = get("/blog/foo/assets/cat.png?w=10", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	// Derived images are served from the cache
+	for key := range images {
+		images[key] = []byte("cached")
+	}
+	rec = get("/blog/foo/assets/cat.png?w=10", nil)
+	assert.Equal(t, "cached", rec.Body.String())
+
+	rec = get("/blog/foo/assets/cat.png", http.Header{"Accept": {"image/jpeg"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get(echo.HeaderContentType))
+	assert.Len(t, images, 2)
+
+	// Unchanged images are streamed as they are
+	rec = get("/blog/foo/assets/cat.png", http.Header{"Accept": {"image/*"}})
+	assert.Equal(t, b.String(), rec.Body.String())
+	assert.Equal(t, `W/"hash-cat.png"`, rec.Header().Get("ETag"))
+
+	for _, target := range []string{"/blog/foo/assets/cat.png?w=0", "/blog/foo/assets/cat.png?fit=squash"} {
+		assert.Equal(t, http.StatusBadRequest, get(target, nil).Code, target)
+	}
+}
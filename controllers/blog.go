@@ -1,57 +1,224 @@
 package controllers
 
 import (
-	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v5"
 	"github.com/zaker/anachrome-be/services"
 	"github.com/zaker/anachrome-be/stores/blog"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// HTML pages may be a few minutes stale, the JSON read by the frontend is revalidated on every use
+const (
+	blogHTMLCacheControl = "public, max-age=300"
+	blogJSONCacheControl = "public, no-cache"
 )
 
 type Blog struct {
 	blogs    blog.BlogStore
+	markdown *services.Markdown
 	basePath string
 }
 
-func NewBlog(blogs blog.BlogStore, basePath string) *Blog {
-	return &Blog{blogs, basePath}
+func NewBlog(blogs blog.BlogStore, markdown *services.Markdown, basePath string) *Blog {
+	return &Blog{blogs, markdown, basePath}
+}
+
+// listOptions reads paging, sorting and date filters from the query parameters
+func listOptions(c *echo.Context) (blog.ListOptions, error) {
+
+	opts := blog.ListOptions{First: blog.DefaultPageSize, After: c.QueryParam("after")}
+	var err error
+	if first := c.QueryParam("first"); len(first) > 0 {
+		opts.First, err = strconv.Atoi(first)
+		if err != nil || opts.First < 1 || opts.First > blog.MaxPageSize {
+			return opts, fmt.Errorf("first must be between 1 and %d", blog.MaxPageSize)
+		}
+	}
+	opts.Sort, err = blog.ParseSortOrder(c.QueryParam("sort"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Since, err = parseDate(c.QueryParam("since"))
+	if err != nil {
+		return opts, fmt.Errorf("since: %w", err)
+	}
+	opts.Until, err = parseDate(c.QueryParam("until"))
+	if err != nil {
+		return opts, fmt.Errorf("until: %w", err)
+	}
+	return opts, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
 }
 
 func (b *Blog) ListBlogPosts(c *echo.Context) error {
 
-	blogPosts := make([]services.BlogPostMeta, 0)
-	bpm, err := b.blogs.GetBlogPostsMeta(context.TODO())
+	defer startSpan(c, "Blog.ListBlogPosts").End()
+	opts, err := listOptions(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	return b.respondBlogPosts(c, opts)
+}
+
+// ListTags lists the tags in use with their number of posts
+func (b *Blog) ListTags(c *echo.Context) error {
+
+	defer startSpan(c, "Blog.ListTags").End()
+	bpm, err := b.blogs.GetBlogPostsMeta(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, blog.CountTags(bpm))
+}
+
+// ListTaggedBlogPosts lists the posts with the tag in the path
+func (b *Blog) ListTaggedBlogPosts(c *echo.Context) error {
+
+	defer startSpan(c, "Blog.ListTaggedBlogPosts", attribute.String("blog.tag", c.Param("tag"))).End()
+	opts, err := listOptions(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	opts.Tag = c.Param("tag")
+	return b.respondBlogPosts(c, opts)
+}
+
+func (b *Blog) respondBlogPosts(c *echo.Context, opts blog.ListOptions) error {
+
+	page, err := b.blogs.GetBlogPostsPage(c.Request().Context(), opts)
+	if errors.Is(err, blog.ErrInvalidListOptions) {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		return err
 	}
 
-	for _, bpmEnt := range bpm {
+	if page.HasNextPage {
+		u := c.Request().URL
+		q := u.Query()
+		q.Set("after", page.EndCursor())
+		c.Response().Header().Set("Link", fmt.Sprintf(`<%s%s?%s>; rel="next"`, b.basePath, u.Path, q.Encode()))
+	}
+
+	blogPosts := make([]services.BlogPostMeta, 0)
+	var modified time.Time
+	for _, bpmEnt := range page.Posts {
 		bm := services.BlogPostMeta{BlogPostMeta: bpmEnt,
-			Path: b.basePath + "/blog/" + bpmEnt.ID}
+			Path: services.BlogPostPath(b.basePath, bpmEnt.ID)}
 		blogPosts = append(blogPosts, bm)
+		modified = latest(modified, lastModified(bpmEnt))
 	}
 
-	if services.WantsHTML(c.Request().Header) {
+	// The listing is cheap to render, so its validator is the hash of the body
+	wantsHTML := services.WantsHTML(c.Request().Header)
+	var body []byte
+	contentType := echo.MIMEApplicationJSON
+	if wantsHTML {
 		htmlStr, err := services.BlogsToHTML(blogPosts)
 		if err != nil {
 			return err
 		}
-		return c.HTML(http.StatusOK, htmlStr)
+		body, contentType = []byte(htmlStr), echo.MIMETextHTMLCharsetUTF8
+	} else {
+		body, err = json.Marshal(blogPosts)
+		if err != nil {
+			return err
+		}
+	}
+
+	setBlogCaching(c, wantsHTML)
+	if notModified(c, weakETag(body), modified) {
+		return c.NoContent(http.StatusNotModified)
 	}
-	return c.JSON(http.StatusOK, blogPosts)
+	return c.Blob(http.StatusOK, contentType, body)
 }
 
 func (b *Blog) GetBlogPost(c *echo.Context) error {
 	id := c.Param("id")
+	defer startSpan(c, "Blog.GetBlogPost", attribute.String("blog.id", id)).End()
 	if len(id) == 0 {
 		return c.JSON(http.StatusNotFound, id)
 	}
-	post, err := b.blogs.GetBlogPost(context.TODO(), id)
+	post, err := b.blogs.GetBlogPost(c.Request().Context(), id)
+	if errors.Is(err, blog.ErrPostNotFound) {
+		return c.JSON(http.StatusNotFound, id)
+	}
 	if err != nil {
 		return err
 	}
 
+	wantsHTML := services.WantsHTML(c.Request().Header)
+	setBlogCaching(c, wantsHTML)
+	if notModified(c, postETag(post, wantsHTML), lastModified(post.Meta)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return respondBlogPost(c, b.markdown, b.basePath, post)
+}
+
+// setBlogCaching sets the caching headers of the post or listing in the negotiated format
+func setBlogCaching(c *echo.Context, wantsHTML bool) {
+	h := c.Response().Header()
+	h.Add(echo.HeaderVary, echo.HeaderAccept)
+	if wantsHTML {
+		h.Set(echo.HeaderCacheControl, blogHTMLCacheControl)
+	} else {
+		h.Set(echo.HeaderCacheControl, blogJSONCacheControl)
+	}
+}
+
+// postETag derives the ETag from the hash of the post file, so that the post is not rendered to validate it.
+// Posts cached before their hash was stored are validated by their markdown instead.
+func postETag(post blog.BlogPost, wantsHTML bool) string {
+	hash := post.Meta.ContentHash
+	if len(hash) == 0 {
+		hash = post.Content
+	}
+	format := "json"
+	if wantsHTML {
+		format = "html"
+	}
+	return weakETag([]byte(hash + "\x00" + post.Meta.Updated.UTC().Format(time.RFC3339Nano) + "\x00" + format))
+}
+
+// lastModified is when the post was updated, or published when it is dated later
+func lastModified(meta blog.BlogPostMeta) time.Time {
+	return latest(meta.Updated, meta.Published)
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// respondBlogPost sends the post as HTML or JSON, rendering it unless the store did
+func respondBlogPost(c *echo.Context, markdown *services.Markdown, basePath string, post blog.BlogPost) error {
+
+	var err error
+	if len(post.ContentHTML) == 0 {
+		post.ContentHTML, err = markdown.RenderPost(c.Request().Context(), post.Content, services.AssetPath(basePath, post.Meta.ID))
+		if err != nil {
+			return err
+		}
+	}
+
 	if services.WantsHTML(c.Request().Header) {
 		htmlStr, err := services.BlogToHTML(post)
 		if err != nil {
@@ -61,3 +228,9 @@ func (b *Blog) GetBlogPost(c *echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, post)
 }
+
+// HighlightStyle serves the stylesheet for highlighted code blocks
+func (b *Blog) HighlightStyle(c *echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=86400")
+	return c.Blob(http.StatusOK, "text/css; charset=utf-8", b.markdown.StyleSheet())
+}
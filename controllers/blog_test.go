@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/middleware"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/cache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestListBlogPosts(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{
+		{ID: "foo", Published: time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC)},
+		{ID: "bar", Published: time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)},
+	}
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsPageFunc: func(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+			return blog.PageOf(metas, opts)
+		},
+	}
+	b := NewBlog(mbs, nil, "/api")
+	e := echo.New()
+
+	list := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		err := b.ListBlogPosts(e.NewContext(req, rec))
+		if err != nil {
+			t.Fatalf("ListBlogPosts() error = %v", err)
+		}
+		return rec
+	}
+
+	rec := list("/blog?first=1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":"bar"`)
+	assert.NotContains(t, rec.Body.String(), `"id":"foo"`)
+	cursor := blog.Cursor(metas[1], blog.SortPublished)
+	assert.Equal(t, `</api/blog?after=`+cursor+`&first=1>; rel="next"`, rec.Header().Get("Link"))
+
+	rec = list("/blog?first=1&after=" + cursor)
+	assert.Contains(t, rec.Body.String(), `"id":"foo"`)
+	assert.Empty(t, rec.Header().Get("Link"))
+
+	rec = list("/blog?until=2021-03-19")
+	assert.Contains(t, rec.Body.String(), `"id":"foo"`)
+	assert.NotContains(t, rec.Body.String(), `"id":"bar"`)
+	// Pages have a default size when none is asked for
+	calls := mbs.GetBlogPostsPageCalls()
+	assert.Equal(t, blog.DefaultPageSize, calls[len(calls)-1].ListOptions.First)
+
+	for _, target := range []string{"/blog?first=0", "/blog?sort=random", "/blog?since=yesterday", "/blog?after=bogus"} {
+		assert.Equal(t, http.StatusBadRequest, list(target).Code, target)
+	}
+}
+
+var (
+	recorderOnce sync.Once
+	testRecorder *tracetest.SpanRecorder
+)
+
+// spanRecorder records the spans of the tests, the global tracer provider is only set once
+func spanRecorder() *tracetest.SpanRecorder {
+	recorderOnce.Do(func() {
+		testRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(testRecorder)))
+	})
+	return testRecorder
+}
+
+func TestGetBlogPost_Tracing(t *testing.T) {
+
+	recorder := spanRecorder()
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id}, Content: "# Foo"}, nil
+		},
+	}
+	c, err := cache.NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := services.NewMarkdown("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(middleware.Tracing())
+	e.GET("/blog/:id", NewBlog(c, md, "").GetBlogPost)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/blog/foo", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	parents := map[string]string{
+		"Blog.GetBlogPost":          "GET /blog/:id",
+		"InMemoryCache.GetBlogPost": "Blog.GetBlogPost",
+		"Markdown.RenderPost":       "Blog.GetBlogPost",
+	}
+	for name, parent := range parents {
+		if assert.Contains(t, spans, name) && assert.Contains(t, spans, parent) {
+			assert.Equal(t, spans[parent].SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+		}
+	}
+	assert.Contains(t, spans["InMemoryCache.GetBlogPost"].Attributes(), attribute.Bool("cache.hit", false))
+}
+
+func TestListBlogPosts_Tracing(t *testing.T) {
+
+	recorder := spanRecorder()
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsMetaFunc: func(ctx context.Context) ([]blog.BlogPostMeta, error) {
+			return []blog.BlogPostMeta{{ID: "foo"}}, nil
+		},
+	}
+	c, err := cache.NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(middleware.Tracing())
+	e.GET("/blog", NewBlog(c, nil, "").ListBlogPosts)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/blog", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	if assert.Contains(t, spans, "InMemoryCache.GetBlogPostsPage") && assert.Contains(t, spans, "Blog.ListBlogPosts") {
+		assert.Equal(t, spans["Blog.ListBlogPosts"].SpanContext().SpanID(), spans["InMemoryCache.GetBlogPostsPage"].Parent().SpanID())
+	}
+}
+
+func TestGetBlogPost_Conditional(t *testing.T) {
+
+	updated := time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC)
+	hash := "a"
+	fetched := 0
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			fetched++
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id, Updated: updated, ContentHash: hash}, Content: "# Foo"}, nil
+		},
+	}
+	c, err := cache.NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := services.NewMarkdown("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.GET("/blog/:id", NewBlog(c, md, "").GetBlogPost)
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/blog/foo", nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, updated.Format(http.TimeFormat), rec.Header().Get(echo.HeaderLastModified))
+	assert.Equal(t, blogJSONCacheControl, rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, echo.HeaderAccept, rec.Header().Get(echo.HeaderVary))
+
+	// Revalidating is answered from the cache
+	rec = get(http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	rec = get(http.Header{"If-Modified-Since": {updated.Format(http.TimeFormat)}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, 1, fetched)
+
+	// HTML is another representation
+	rec = get(http.Header{"Accept": {"text/html"}, "If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+	assert.Equal(t, blogHTMLCacheControl, rec.Header().Get(echo.HeaderCacheControl))
+
+	// An edited post is sent again
+	hash = "b"
+	assert.NoError(t, c.Invalidate(context.Background(), "foo"))
+	rec = get(http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+	assert.Equal(t, 2, fetched)
+}
+
+func TestListBlogPosts_Conditional(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{
+		{ID: "foo", Published: time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC), Updated: time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{ID: "bar", Published: time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)},
+	}
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsPageFunc: func(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+			return blog.PageOf(metas, opts)
+		},
+	}
+	b := NewBlog(mbs, nil, "")
+	e := echo.New()
+
+	list := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		err := b.ListBlogPosts(e.NewContext(req, rec))
+		if err != nil {
+			t.Fatalf("ListBlogPosts() error = %v", err)
+		}
+		return rec
+	}
+
+	rec := list("/blog", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, metas[0].Updated.Format(http.TimeFormat), rec.Header().Get(echo.HeaderLastModified))
+	etag := rec.Header().Get("ETag")
+
+	assert.Equal(t, http.StatusNotModified, list("/blog", etag).Code)
+	// Another page has another ETag
+	assert.Equal(t, http.StatusOK, list("/blog?first=1", etag).Code)
+
+	metas[1].Title = "Bar"
+	assert.Equal(t, http.StatusOK, list("/blog", etag).Code)
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+// weakETag is an ETag derived from the hash of the given content. It is weak, since
+// the gzip middleware compresses responses without changing their ETag.
+func weakETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return weakTag(hex.EncodeToString(sum[:16]))
+}
+
+// weakTag quotes the opaque tag as a weak ETag
+func weakTag(tag string) string {
+	return `W/"` + tag + `"`
+}
+
+// notModified sets the validators on the response and reports whether the
+// request preconditions show that the client already has this representation
+func notModified(c *echo.Context, etag string, lastModified time.Time) bool {
+
+	h := c.Response().Header()
+	if len(etag) > 0 {
+		h.Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		h.Set(echo.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	req := c.Request()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since, RFC 9110 13.1.3,
+	// and uses the weak comparison
+	if inm := req.Header.Get("If-None-Match"); len(inm) > 0 {
+		if len(etag) == 0 {
+			return false
+		}
+		opaque := strings.TrimPrefix(etag, "W/")
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == opaque {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := req.Header.Get(echo.HeaderIfModifiedSince); len(ims) > 0 && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
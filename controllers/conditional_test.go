@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+func Test_notModified(t *testing.T) {
+
+	etag := weakETag([]byte("content"))
+	modified := time.Date(2021, 3, 18, 10, 27, 30, 500, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{"No preconditions", http.Header{}, false},
+		{"Matching etag", http.Header{"If-None-Match": []string{etag}}, true},
+		{"Strong matching etag", http.Header{"If-None-Match": []string{`"other", ` + strings.TrimPrefix(etag, "W/")}}, true},
+		{"Any etag", http.Header{"If-None-Match": []string{"*"}}, true},
+		{"Other etag", http.Header{"If-None-Match": []string{`"other"`}}, false},
+		{"Etag wins over date", http.Header{
+			"If-None-Match":     []string{`"other"`},
+			"If-Modified-Since": []string{modified.Format(http.TimeFormat)},
+		}, false},
+		{"Not modified since", http.Header{"If-Modified-Since": []string{modified.Format(http.TimeFormat)}}, true},
+		{"Modified since", http.Header{"If-Modified-Since": []string{modified.Add(-time.Minute).Format(http.TimeFormat)}}, false},
+		{"Bad date", http.Header{"If-Modified-Since": []string{"yesterday"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			if got := notModified(c, etag, modified); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %v, want %v", got, etag)
+			}
+			if got := rec.Header().Get("Last-Modified"); got != "Thu, 18 Mar 2021 10:27:30 GMT" {
+				t.Errorf("Last-Modified = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+// DropboxSyncer syncs the Dropbox folder when told it changed
+type DropboxSyncer interface {
+	RequestSync()
+}
+
+type DropboxWebhook struct {
+	appSecret []byte
+	syncer    DropboxSyncer
+}
+
+func NewDropboxWebhook(appSecret string, syncer DropboxSyncer) *DropboxWebhook {
+	return &DropboxWebhook{[]byte(appSecret), syncer}
+}
+
+// Challenge echoes the challenge Dropbox sends to verify the webhook
+func (d *DropboxWebhook) Challenge(c *echo.Context) error {
+
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.String(http.StatusOK, c.QueryParam("challenge"))
+}
+
+// Notify syncs the folder when Dropbox signals that files changed
+func (d *DropboxWebhook) Notify(c *echo.Context) error {
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	if !d.validSignature(body, c.Request().Header.Get("X-Dropbox-Signature")) {
+		return c.NoContent(http.StatusForbidden)
+	}
+
+	d.syncer.RequestSync()
+	return c.NoContent(http.StatusOK)
+}
+
+// validSignature checks the hex encoded HMAC-SHA256 of the body keyed with the app secret
+func (d *DropboxWebhook) validSignature(body []byte, signature string) bool {
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, d.appSecret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
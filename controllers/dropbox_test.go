@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type syncCounter int
+
+func (s *syncCounter) RequestSync() {
+	*s++
+}
+
+func TestDropboxWebhook(t *testing.T) {
+
+	var syncs syncCounter
+	d := NewDropboxWebhook("app-secret", &syncs)
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/dropbox/webhook?challenge=abc123", nil)
+	rec := httptest.NewRecorder()
+	err := d.Challenge(e.NewContext(req, rec))
+	if err != nil {
+		t.Fatalf("Challenge() error = %v", err)
+	}
+	assert.Equal(t, "abc123", rec.Body.String())
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+
+	notification := `{"list_folder": {"accounts": ["dbid:AAH4f99T0taONIb-OurWxbNQ6ywGRopQngc"]}, "delta": {"users": [12345678]}}`
+	mac := hmac.New(sha256.New, []byte("app-secret"))
+	mac.Write([]byte(notification))
+	validSignature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		signature string
+		want      int
+		wantSyncs syncCounter
+	}{
+		{"Missing signature", "", http.StatusForbidden, 0},
+		{"Wrong signature", strings.Repeat("0", 64), http.StatusForbidden, 0},
+		{"Valid signature", validSignature, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/dropbox/webhook", strings.NewReader(notification))
+			req.Header.Set("X-Dropbox-Signature", tt.signature)
+			rec := httptest.NewRecorder()
+			err := d.Notify(e.NewContext(req, rec))
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Equal(t, tt.wantSyncs, syncs)
+		})
+	}
+}
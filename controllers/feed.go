@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v5"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+type Feed struct {
+	blogs    blog.BlogStore
+	markdown *services.Markdown
+	basePath string
+	title    string
+	limit    int
+}
+
+func NewFeed(blogs blog.BlogStore, markdown *services.Markdown, basePath, title string, limit int) *Feed {
+	if len(title) == 0 {
+		title = basePath
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	return &Feed{blogs, markdown, basePath, title, limit}
+}
+
+func (f *Feed) buildFeed(ctx context.Context) (services.Feed, error) {
+
+	bpm, err := f.blogs.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return services.Feed{}, err
+	}
+	slices.SortFunc(bpm, func(a, b blog.BlogPostMeta) int {
+		return b.Published.Compare(a.Published)
+	})
+	if len(bpm) > f.limit {
+		bpm = bpm[:f.limit]
+	}
+
+	feed := services.Feed{
+		Title:   f.title,
+		Link:    f.basePath,
+		Entries: make([]services.FeedEntry, 0, len(bpm)),
+	}
+	for _, meta := range bpm {
+		post, err := f.blogs.GetBlogPost(ctx, meta.ID)
+		if err != nil {
+			return services.Feed{}, err
+		}
+		if len(post.ContentHTML) == 0 {
+			post.ContentHTML, err = f.markdown.RenderPost(ctx, post.Content, services.AssetPath(f.basePath, meta.ID))
+			if err != nil {
+				return services.Feed{}, err
+			}
+		}
+
+		updated := lastModified(meta)
+		feed.Updated = latest(feed.Updated, updated)
+		feed.Entries = append(feed.Entries, services.FeedEntry{
+			Title:       meta.Title,
+			Link:        services.BlogPostPath(f.basePath, meta.ID),
+			Published:   meta.Published,
+			Updated:     updated,
+			ContentHTML: post.ContentHTML,
+		})
+	}
+	return feed, nil
+}
+
+func (f *Feed) serve(c *echo.Context, contentType string, render func(services.Feed) ([]byte, error)) error {
+
+	feed, err := f.buildFeed(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	body, err := render(feed)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+	if notModified(c, weakETag(body), feed.Updated) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, contentType, body)
+}
+
+// Atom serves the latest posts as an Atom feed
+func (f *Feed) Atom(c *echo.Context) error {
+	return f.serve(c, "application/atom+xml; charset=utf-8", services.Feed.Atom)
+}
+
+// RSS serves the latest posts as an RSS feed
+func (f *Feed) RSS(c *echo.Context) error {
+	return f.serve(c, "application/rss+xml; charset=utf-8", services.Feed.RSS)
+}
+
+// JSON serves the latest posts as a JSON Feed
+func (f *Feed) JSON(c *echo.Context) error {
+	return f.serve(c, "application/feed+json; charset=utf-8", services.Feed.JSON)
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+// HealthCheck reports an error when a dependency cannot be used
+type HealthCheck func(context.Context) error
+
+// healthCheckTimeout is how long readiness waits for the checks
+const healthCheckTimeout = 5 * time.Second
+
+const (
+	statusOK      = "ok"
+	statusFailing = "failing"
+)
+
+type Health struct {
+	checks map[string]HealthCheck
+}
+
+// NewHealth answers liveness probes while the process runs,
+// and readiness probes when every check passes
+func NewHealth(checks map[string]HealthCheck) *Health {
+	return &Health{checks}
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	// Duration is the number of seconds the check took
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Live reports that the server is up
+func (h *Health) Live(c *echo.Context) error {
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusOK, healthReport{Status: statusOK})
+}
+
+// Ready runs the checks concurrently and reports each, it fails when any check fails
+func (h *Health) Ready(c *echo.Context) error {
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+	defer cancel()
+
+	report := healthReport{Status: statusOK, Checks: make(map[string]checkResult, len(h.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range h.checks {
+		wg.Go(func() {
+			start := time.Now()
+			err := check(ctx)
+			res := checkResult{Status: statusOK, Duration: time.Since(start).Seconds()}
+			if err != nil {
+				res.Status = statusFailing
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = statusFailing
+			}
+		})
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if report.Status != statusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(status, report)
+}
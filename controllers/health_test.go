@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+
+	redisUp := true
+	h := NewHealth(map[string]HealthCheck{
+		"dropbox": func(ctx context.Context) error { return nil },
+		"redis": func(ctx context.Context) error {
+			if !redisUp {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	})
+	e := echo.New()
+	e.GET("/healthz", h.Live)
+	e.GET("/readyz", h.Ready)
+	request := func(target string) (*httptest.ResponseRecorder, healthReport) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var report healthReport
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+		return rec, report
+	}
+
+	rec, report := request("/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, statusOK, report.Status)
+	assert.Equal(t, statusOK, report.Checks["dropbox"].Status)
+	assert.Equal(t, statusOK, report.Checks["redis"].Status)
+
+	redisUp = false
+	rec, report = request("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, statusFailing, report.Status)
+	assert.Equal(t, statusOK, report.Checks["dropbox"].Status)
+	assert.Equal(t, checkResult{Status: statusFailing, Duration: report.Checks["redis"].Duration, Error: "connection refused"}, report.Checks["redis"])
+
+	rec, report = request("/healthz")
+	assert.Equal(t, http.StatusOK, rec.Code, "alive while dependencies fail")
+	assert.Equal(t, healthReport{Status: statusOK}, report)
+}
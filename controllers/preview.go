@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+type Preview struct {
+	drafts   blog.BlogStore
+	signer   *services.PreviewSigner
+	markdown *services.Markdown
+	basePath string
+}
+
+// NewPreview shows posts of the drafts store, which includes drafts and scheduled posts, to holders of signed links
+func NewPreview(drafts blog.BlogStore, signer *services.PreviewSigner, markdown *services.Markdown, basePath string) *Preview {
+	return &Preview{drafts, signer, markdown, basePath}
+}
+
+// GetPreview shows a post whether it is published or not, if the link is signed and not expired
+func (p *Preview) GetPreview(c *echo.Context) error {
+
+	id := c.Param("id")
+	err := p.signer.Verify(id, c.QueryParams())
+	if errors.Is(err, services.ErrPreviewExpired) {
+		return c.JSON(http.StatusGone, err.Error())
+	}
+	if err != nil {
+		return c.JSON(http.StatusForbidden, err.Error())
+	}
+
+	post, err := p.drafts.GetBlogPost(c.Request().Context(), id)
+	if errors.Is(err, blog.ErrPostNotFound) {
+		return c.JSON(http.StatusNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Previews are personal and must not end up in shared caches or search engines
+	h := c.Response().Header()
+	h.Set(echo.HeaderCacheControl, "private, no-store")
+	h.Set("X-Robots-Tag", "noindex")
+	return respondBlogPost(c, p.markdown, p.basePath, post)
+}
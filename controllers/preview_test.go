@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+func TestGetPreview(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			if id == "gone" {
+				return blog.BlogPost{}, blog.ErrPostNotFound
+			}
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id, Draft: true}, Content: "Not *yet*"}, nil
+		},
+	}
+	markdown, err := services.NewMarkdown("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := services.NewPreviewSigner("secret")
+	p := NewPreview(mbs, signer, markdown, "")
+	e := echo.New()
+	e.GET("/blog/:id/preview", p.GetPreview)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(signer.URL("", "foo", time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"contentHTML":"\u003cp\u003eNot \u003cem\u003eyet`)
+	assert.Equal(t, "private, no-store", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, "noindex", rec.Header().Get("X-Robots-Tag"))
+
+	assert.Equal(t, http.StatusGone, get(signer.URL("", "foo", time.Now().Add(-time.Hour))).Code)
+	// The signature of one post does not show another
+	signed := signer.URL("", "foo", time.Now().Add(time.Hour))
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(signed, "/foo/", "/bar/", 1)).Code)
+	other := services.NewPreviewSigner("other")
+	assert.Equal(t, http.StatusForbidden, get(other.URL("", "foo", time.Now().Add(time.Hour))).Code)
+	assert.Equal(t, http.StatusForbidden, get("/blog/foo/preview").Code)
+	assert.Equal(t, http.StatusNotFound, get(signer.URL("", "gone", time.Now().Add(time.Hour))).Code)
+	assert.Len(t, mbs.GetBlogPostCalls(), 2)
+}
+
+func TestGetBlogPost_NotPublished(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{}, blog.ErrPostNotFound
+		},
+	}
+	e := echo.New()
+	e.GET("/blog/:id", NewBlog(mbs, nil, "").GetBlogPost)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/blog/draft", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
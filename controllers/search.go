@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v5"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/search"
+)
+
+type Search struct {
+	index    *search.Index
+	basePath string
+}
+
+func NewSearch(index *search.Index, basePath string) *Search {
+	return &Search{index, basePath}
+}
+
+// Search lists the posts matching the q query parameter, best matches first
+func (s *Search) Search(c *echo.Context) error {
+
+	q := c.QueryParam("q")
+	if len(strings.TrimSpace(q)) == 0 {
+		return c.JSON(http.StatusBadRequest, "missing query")
+	}
+	limit := 20
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	results := make([]services.SearchResult, 0)
+	for _, res := range s.index.Search(q, limit) {
+		results = append(results, services.SearchResult{
+			BlogPostMeta: services.BlogPostMeta{
+				BlogPostMeta: res.Meta,
+				Path:         services.BlogPostPath(s.basePath, res.Meta.ID)},
+			Score:   res.Score,
+			Snippet: res.Snippet,
+		})
+	}
+	return c.JSON(http.StatusOK, results)
+}
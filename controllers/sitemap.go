@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/zaker/anachrome-be/services"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+type Sitemap struct {
+	blogs    blog.BlogStore
+	basePath string
+	robots   string
+
+	mu       sync.RWMutex
+	sitemap  []byte
+	etag     string
+	modified time.Time
+}
+
+func NewSitemap(blogs blog.BlogStore, basePath, robotsRules string) *Sitemap {
+	return &Sitemap{
+		blogs:    blogs,
+		basePath: basePath,
+		robots:   services.Robots(basePath, robotsRules)}
+}
+
+// Regenerate rebuilds the cached sitemap from the blog store
+func (s *Sitemap) Regenerate(ctx context.Context) error {
+
+	bpm, err := s.blogs.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return err
+	}
+	sitemap, modified, err := services.Sitemap(s.basePath, bpm)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sitemap = sitemap
+	s.etag = weakETag(sitemap)
+	s.modified = modified
+	return nil
+}
+
+// Invalidate regenerates the sitemap when a post changes
+func (s *Sitemap) Invalidate(ctx context.Context, id string) error {
+	err := s.Regenerate(ctx)
+	if err != nil {
+		s.mu.Lock()
+		s.sitemap = nil
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Sitemap) SitemapXML(c *echo.Context) error {
+
+	s.mu.RLock()
+	sitemap, etag, modified := s.sitemap, s.etag, s.modified
+	s.mu.RUnlock()
+
+	if sitemap == nil {
+		err := s.Regenerate(c.Request().Context())
+		if err != nil {
+			return err
+		}
+		s.mu.RLock()
+		sitemap, etag, modified = s.sitemap, s.etag, s.modified
+		s.mu.RUnlock()
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=3600")
+	if notModified(c, etag, modified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, "application/xml; charset=utf-8", sitemap)
+}
+
+func (s *Sitemap) RobotsTXT(c *echo.Context) error {
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=86400")
+	return c.Blob(http.StatusOK, "text/plain; charset=utf-8", []byte(s.robots))
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+func TestSitemap(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{{ID: "foo", Updated: time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC)}}
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsMetaFunc: func(ctx context.Context) ([]blog.BlogPostMeta, error) {
+			return metas, nil
+		},
+	}
+	s := NewSitemap(mbs, "https://example.com", "")
+	e := echo.New()
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		err := s.SitemapXML(e.NewContext(req, rec))
+		if err != nil {
+			t.Fatalf("SitemapXML() error = %v", err)
+		}
+		return rec
+	}
+
+	rec := get(http.Header{})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "https://example.com/blog/foo")
+	etag := rec.Header().Get("ETag")
+
+	rec = get(http.Header{"If-None-Match": []string{etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	// Cached until a post changes
+	get(http.Header{})
+	assert.Len(t, mbs.GetBlogPostsMetaCalls(), 1)
+
+	metas = append(metas, blog.BlogPostMeta{ID: "bar", Updated: time.Date(2021, 3, 19, 10, 27, 0, 0, time.UTC)})
+	err := s.Invalidate(context.Background(), "bar")
+	if err != nil {
+		t.Fatalf("Invalidate() error = %v", err)
+	}
+	assert.Len(t, mbs.GetBlogPostsMetaCalls(), 2)
+
+	rec = get(http.Header{"If-None-Match": []string{etag}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "https://example.com/blog/bar")
+	assert.Equal(t, "Fri, 19 Mar 2021 10:27:00 GMT", rec.Header().Get("Last-Modified"))
+
+	req := httptest.NewRequest(http.MethodGet, "/robots.txt", nil)
+	rec = httptest.NewRecorder()
+	err = s.RobotsTXT(e.NewContext(req, rec))
+	if err != nil {
+		t.Fatalf("RobotsTXT() error = %v", err)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "Sitemap: https://example.com/sitemap.xml\n") {
+		t.Errorf("RobotsTXT() = %q, should reference the sitemap", rec.Body.String())
+	}
+}
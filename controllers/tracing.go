@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"github.com/labstack/echo/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/zaker/anachrome-be/controllers")
+
+// startSpan starts a span for the handler in the trace of the request,
+// the request context carries it to the stores the handler calls
+func startSpan(c *echo.Context, name string, attrs ...attribute.KeyValue) trace.Span {
+
+	ctx, span := tracer.Start(c.Request().Context(), name, trace.WithAttributes(attrs...))
+	c.SetRequest(c.Request().WithContext(ctx))
+	return span
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v5"
+)
+
+// AccessLog middleware logs a structured record of each request when it is served,
+// server errors at error level
+func AccessLog(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			req := c.Request()
+			status := responseStatus(c, err)
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("route", c.Path()),
+				slog.String("uri", req.RequestURI),
+				slog.Int("status", status),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_ip", c.RealIP()),
+				slog.String("user_agent", req.UserAgent()),
+			}
+			if resp, _ := echo.UnwrapResponse(c.Response()); resp != nil {
+				attrs = append(attrs, slog.Int64("bytes", resp.Size))
+			}
+			level := slog.LevelInfo
+			if err != nil {
+				attrs = append(attrs, slog.Any("err", err))
+			}
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(req.Context(), level, "request", attrs...)
+			return err
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+)
+
+// claimsKey is where the claims of a validated token are kept on the context
+const claimsKey = "jwtClaims"
+
+// jwksRefreshInterval is the least time between fetching the keys of the auth server
+const jwksRefreshInterval = time.Minute
+
+// jwksMaxAge is how long fetched keys are used before they are fetched again
+const jwksMaxAge = time.Hour
+
+// JWTConfig validation of bearer tokens
+type JWTConfig struct {
+	// Secret verifies HS256 tokens
+	Secret []byte
+	// JWKSURL is where the keys verifying RS256 and ES256 tokens are fetched from
+	JWKSURL  string
+	Audience string
+	Issuer   string
+	Client   *http.Client
+}
+
+// Claims of a validated token
+type Claims struct {
+	jwt.RegisteredClaims
+	// Scope is a space separated list of scopes, RFC 8693
+	Scope string `json:"scope,omitempty"`
+	// Scp lists scopes the way some auth servers do
+	Scp []string `json:"scp,omitempty"`
+}
+
+// Scopes the token is granted
+func (c *Claims) Scopes() []string {
+	return append(strings.Fields(c.Scope), c.Scp...)
+}
+
+// TokenClaims returns the claims of the token the JWT middleware validated
+func TokenClaims(c *echo.Context) (*Claims, bool) {
+	claims, ok := c.Get(claimsKey).(*Claims)
+	return claims, ok
+}
+
+// JWT middleware requires a valid bearer token, with expiry and the configured audience and issuer
+func JWT(config JWTConfig) echo.MiddlewareFunc {
+
+	var methods []string
+	if len(config.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	var keys *jwks
+	if len(config.JWKSURL) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+		client := config.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		keys = &jwks{url: config.JWKSURL, client: client}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if len(config.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+	if len(config.Issuer) > 0 {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	parser := jwt.NewParser(opts...)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			scheme, raw, ok := strings.Cut(auth, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				return unauthorized(c, "", "bearer token required")
+			}
+
+			claims := &Claims{}
+			_, err := parser.ParseWithClaims(strings.TrimSpace(raw), claims, func(t *jwt.Token) (any, error) {
+				if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+					return config.Secret, nil
+				}
+				if keys == nil {
+					return nil, errors.New("no keys for " + t.Method.Alg())
+				}
+				kid, _ := t.Header["kid"].(string)
+				return keys.key(c.Request().Context(), kid)
+			})
+			if err != nil {
+				return unauthorized(c, "invalid_token", err.Error())
+			}
+			c.Set(claimsKey, claims)
+			return next(c)
+		}
+	}
+}
+
+// RequireScopes middleware requires the validated token to be granted all the scopes
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			claims, ok := TokenClaims(c)
+			if !ok {
+				return unauthorized(c, "", "bearer token required")
+			}
+			granted := claims.Scopes()
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate,
+						fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+					return c.JSON(http.StatusForbidden, "missing scope "+scope)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// unauthorized challenges the client for a bearer token, RFC 6750 3
+func unauthorized(c *echo.Context, code, description string) error {
+	challenge := "Bearer"
+	if len(code) > 0 {
+		challenge += fmt.Sprintf(` error=%q`, code)
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+	return c.JSON(http.StatusUnauthorized, description)
+}
+
+// jwks fetches and keeps the public keys of the auth server by key ID
+type jwks struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// key returns the key with the ID, fetching the keys again when it is unknown
+// or they are old, but not more often than the refresh interval
+func (ks *jwks) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[kid]
+	age := time.Since(ks.fetched)
+	if (ok && age < jwksMaxAge) || (!ok && age < jwksRefreshInterval) {
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	}
+
+	keys, err := ks.fetch(ctx)
+	if err != nil {
+		// Keep using known keys while the auth server is unavailable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	ks.keys, ks.fetched = keys, time.Now()
+	key, ok = ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (ks *jwks) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching keys: %s", resp.Status)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, fmt.Errorf("decoding keys: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Keys of other types are of no use here, but do not stop the others from working
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if x.BitLen() > 256 || y.BitLen() > 256 {
+			return nil, errors.New("coordinates too large")
+		}
+		// The uncompressed point is only accepted when it is on the curve
+		point := make([]byte, 65)
+		point[0] = 4
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
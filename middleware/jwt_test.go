@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// jwksServer publishes the public keys by key ID
+func jwksServer(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) (*httptest.Server, *atomic.Int32) {
+
+	fetches := &atomic.Int32{}
+	x, y := ecKey.X.FillBytes(make([]byte, 32)), ecKey.Y.FillBytes(make([]byte, 32))
+	set := map[string]any{"keys": []map[string]string{
+		{"kid": "rsa", "kty": "RSA", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kid": "ec", "kty": "EC", "crv": "P-256",
+			"x": base64.RawURLEncoding.EncodeToString(x), "y": base64.RawURLEncoding.EncodeToString(y)},
+		{"kid": "enc", "kty": "RSA", "use": "enc", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kid": "okp", "kty": "OKP", "crv": "Ed25519", "x": "AAAA"},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, fetches
+}
+
+func TestJWT(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, fetches := jwksServer(t, rsaKey, ecKey)
+	secret := []byte("secret")
+
+	e := echo.New()
+	admin := e.Group("/admin", JWT(JWTConfig{
+		Secret:   secret,
+		JWKSURL:  srv.URL,
+		Audience: "anachrome",
+		Issuer:   "https://auth.example.com/",
+		Client:   srv.Client(),
+	}))
+	admin.GET("/whoami", func(c *echo.Context) error {
+		claims, _ := TokenClaims(c)
+		return c.JSON(http.StatusOK, claims.Scopes())
+	})
+	admin.POST("/flush", func(c *echo.Context) error { return c.NoContent(http.StatusNoContent) }, RequireScopes("cache:write"))
+
+	claims := func(mod func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"sub":   "me",
+			"aud":   "anachrome",
+			"iss":   "https://auth.example.com/",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "cache:read cache:write",
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		if len(kid) > 0 {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	request := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if len(token) > 0 {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"HS256", sign(jwt.SigningMethodHS256, "", secret, claims(nil))},
+		{"RS256", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil))},
+		{"ES256", sign(jwt.SigningMethodES256, "ec", ecKey, claims(nil))},
+	} {
+		rec := request(http.MethodGet, "/admin/whoami", tc.token)
+		assert.Equal(t, http.StatusOK, rec.Code, tc.name)
+		assert.JSONEq(t, `["cache:read", "cache:write"]`, rec.Body.String(), tc.name)
+	}
+	assert.Equal(t, int32(1), fetches.Load(), "keys are fetched once")
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"No token", ""},
+		{"Garbage", "not.a.token"},
+		{"Wrong secret", sign(jwt.SigningMethodHS256, "", []byte("guess"), claims(nil))},
+		{"HS384", sign(jwt.SigningMethodHS384, "", secret, claims(nil))},
+		{"None", sign(jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil))},
+		{"Expired", sign(jwt.SigningMethodHS256, "", secret, claims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }))},
+		{"No expiry", sign(jwt.SigningMethodHS256, "", secret, claims(func(c jwt.MapClaims) { delete(c, "exp") }))},
+		{"Other audience", sign(jwt.SigningMethodHS256, "", secret, claims(func(c jwt.MapClaims) { c["aud"] = "other" }))},
+		{"Other audience from the auth server", sign(jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) { c["aud"] = "other" }))},
+		{"No audience from the auth server", sign(jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) { delete(c, "aud") }))},
+		{"Other issuer", sign(jwt.SigningMethodHS256, "", secret, claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com/" }))},
+		{"Unknown key", sign(jwt.SigningMethodRS256, "other", rsaKey, claims(nil))},
+		{"Encryption key", sign(jwt.SigningMethodRS256, "enc", rsaKey, claims(nil))},
+		{"Key of other type", sign(jwt.SigningMethodRS256, "ec", rsaKey, claims(nil))},
+	} {
+		rec := request(http.MethodGet, "/admin/whoami", tc.token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, tc.name)
+		assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), "Bearer", tc.name)
+	}
+	assert.Equal(t, int32(1), fetches.Load(), "unknown keys are not fetched again right away")
+
+	assert.Equal(t, http.StatusNoContent, request(http.MethodPost, "/admin/flush", sign(jwt.SigningMethodHS256, "", secret, claims(nil))).Code)
+	rec := request(http.MethodPost, "/admin/flush", sign(jwt.SigningMethodHS256, "", secret, claims(func(c jwt.MapClaims) {
+		c["scope"] = "cache:read"
+	})))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, `Bearer error="insufficient_scope", scope="cache:write"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+
+	// Scopes may also be listed in scp
+	rec = request(http.MethodPost, "/admin/flush", sign(jwt.SigningMethodHS256, "", secret, claims(func(c jwt.MapClaims) {
+		delete(c, "scope")
+		c["scp"] = []string{"cache:write"}
+	})))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestJWT_KeyRotation(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, fetches := jwksServer(t, rsaKey, ecKey)
+
+	ks := &jwks{url: srv.URL, client: srv.Client()}
+	ctx := t.Context()
+	_, err = ks.key(ctx, "rsa")
+	assert.NoError(t, err)
+
+	// Unknown keys are looked up again once the refresh interval passed, new keys may have been published
+	ks.fetched = time.Now().Add(-jwksRefreshInterval)
+	_, err = ks.key(ctx, "new")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// Known keys are used while the auth server is down
+	ks.fetched = time.Now().Add(-jwksMaxAge)
+	srv.Close()
+	_, err = ks.key(ctx, "ec")
+	assert.NoError(t, err)
+}
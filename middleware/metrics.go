@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anachrome_http_requests_total",
+		Help: "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "anachrome_http_request_duration_seconds",
+		Help:    "Time to serve HTTP requests by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Metrics middleware counts and times requests per route, the route pattern keeps the number of series bounded
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if len(route) == 0 {
+				route = "unmatched"
+			}
+			status := responseStatus(c, err)
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(status),
+			}
+			httpRequests.With(labels).Inc()
+			httpDuration.With(labels).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// responseStatus is the status sent, or that the error handler will send for the error
+func responseStatus(c *echo.Context, err error) int {
+
+	resp, _ := echo.UnwrapResponse(c.Response())
+	if resp != nil && resp.Committed {
+		return resp.Status
+	}
+	if err != nil {
+		var sc echo.HTTPStatusCoder
+		if errors.As(err, &sc) && sc.StatusCode() != 0 {
+			return sc.StatusCode()
+		}
+		return http.StatusInternalServerError
+	}
+	if resp != nil && resp.Status != 0 {
+		return resp.Status
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+
+	e := echo.New()
+	e.Use(Metrics())
+	e.GET("/blog/:id", func(c *echo.Context) error {
+		if c.Param("id") == "missing" {
+			return echo.ErrNotFound
+		}
+		return c.String(http.StatusOK, c.Param("id"))
+	})
+	e.POST("/fail", func(c *echo.Context) error {
+		return echo.ErrUnsupportedMediaType
+	})
+
+	count := func(method, route, status string) float64 {
+		return testutil.ToFloat64(httpRequests.WithLabelValues(method, route, status))
+	}
+	before := map[string]float64{
+		"ok":        count(http.MethodGet, "/blog/:id", "200"),
+		"not found": count(http.MethodGet, "/blog/:id", "404"),
+		"error":     count(http.MethodPost, "/fail", "415"),
+		"unmatched": count(http.MethodGet, "unmatched", "404"),
+	}
+	for _, target := range []string{"/blog/foo", "/blog/bar", "/blog/missing", "/nowhere"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/fail", nil))
+
+	assert.Equal(t, 2.0, count(http.MethodGet, "/blog/:id", "200")-before["ok"], "posts share the route")
+	assert.Equal(t, 1.0, count(http.MethodGet, "/blog/:id", "404")-before["not found"])
+	assert.Equal(t, 1.0, count(http.MethodPost, "/fail", "415")-before["error"])
+	assert.Equal(t, 1.0, count(http.MethodGet, "unmatched", "404")-before["unmatched"])
+	assert.GreaterOrEqual(t, testutil.CollectAndCount(httpDuration), 4, "latency per route and status")
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+
+	"github.com/labstack/echo/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDKey struct{}
+
+// validRequestID limits request IDs passed on by proxies to what is safe to log and echo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID middleware assigns each request an ID, or keeps the valid X-Request-ID of the proxy.
+// The ID is echoed in X-Request-ID and the request context carries it to the logs.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+			return next(c)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromContext is the ID of the request being served, if any
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+// ContextHandler adds the request ID and trace ID in the context to the records logged with it
+func ContextHandler(h slog.Handler) slog.Handler {
+	return contextHandler{h}
+}
+
+func (ch contextHandler) Handle(ctx context.Context, r slog.Record) error {
+
+	if id, ok := RequestIDFromContext(ctx); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return ch.Handler.Handle(ctx, r)
+}
+
+func (ch contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{ch.Handler.WithAttrs(attrs)}
+}
+
+func (ch contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{ch.Handler.WithGroup(name)}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(ContextHandler(slog.NewJSONHandler(buf, nil)))
+
+	e := echo.New()
+	e.Use(RequestID())
+	e.Use(AccessLog(logger))
+	e.GET("/blog/:id", func(c *echo.Context) error {
+		logger.InfoContext(c.Request().Context(), "serving", slog.String("id", c.Param("id")))
+		return c.String(http.StatusOK, c.Param("id"))
+	})
+	request := func(requestID string) (*httptest.ResponseRecorder, []map[string]any) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/blog/foo?x=1", nil)
+		if len(requestID) > 0 {
+			req.Header.Set(echo.HeaderXRequestID, requestID)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(line), &record))
+			records = append(records, record)
+		}
+		return rec, records
+	}
+
+	rec, records := request("")
+	id := rec.Header().Get(echo.HeaderXRequestID)
+	assert.Len(t, id, 32)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "serving", records[0]["msg"])
+		assert.Equal(t, id, records[0]["request_id"], "handlers log with the request ID")
+
+		access := records[1]
+		assert.Equal(t, "request", access["msg"])
+		assert.Equal(t, id, access["request_id"])
+		assert.Equal(t, "GET", access["method"])
+		assert.Equal(t, "/blog/:id", access["route"])
+		assert.Equal(t, "/blog/foo?x=1", access["uri"])
+		assert.Equal(t, float64(http.StatusOK), access["status"])
+		assert.Equal(t, float64(3), access["bytes"])
+	}
+
+	rec, records = request("proxy-1234")
+	assert.Equal(t, "proxy-1234", rec.Header().Get(echo.HeaderXRequestID), "IDs of proxies are kept")
+	assert.Equal(t, "proxy-1234", records[1]["request_id"])
+
+	rec, _ = request("bad id\nforged=1")
+	assert.Len(t, rec.Header().Get(echo.HeaderXRequestID), 32, "invalid IDs are replaced")
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	e := echo.New()
+	e.Use(Tracing())
+	var handlerSpan trace.SpanContext
+	e.GET("/blog/:id", func(c *echo.Context) error {
+		handlerSpan = trace.SpanContextFromContext(c.Request().Context())
+		if c.Param("id") == "broken" {
+			return echo.ErrInternalServerError
+		}
+		return c.String(http.StatusOK, c.Param("id"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/blog/foo", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/blog/broken", nil))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	span := spans[0]
+	assert.Equal(t, "GET /blog/:id", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.SpanContext().TraceID().String(), "continues the trace of the caller")
+	assert.Equal(t, "b7ad6b7169203331", span.Parent().SpanID().String())
+	assert.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Equal(t, codes.Unset, span.Status().Code)
+
+	failed := spans[1]
+	assert.Equal(t, handlerSpan, failed.SpanContext(), "handlers see the span in the request context")
+	assert.False(t, failed.Parent().IsValid(), "starts a trace without traceparent")
+	assert.Contains(t, failed.Attributes(), attribute.Int("http.response.status_code", http.StatusInternalServerError))
+	assert.Equal(t, codes.Error, failed.Status().Code)
+}
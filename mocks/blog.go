@@ -15,22 +15,25 @@ var _ blog.BlogStore = &MockBlogStore{}
 
 // MockBlogStore is a mock implementation of blog.BlogStore.
 //
-// 	func TestSomethingThatUsesBlogStore(t *testing.T) {
+//	func TestSomethingThatUsesBlogStore(t *testing.T) {
 //
-// 		// make and configure a mocked blog.BlogStore
-// 		mockedBlogStore := &MockBlogStore{
-// 			GetBlogPostFunc: func(contextMoqParam context.Context, s string) (blog.BlogPost, error) {
-// 				panic("mock out the GetBlogPost method")
-// 			},
-// 			GetBlogPostsMetaFunc: func(contextMoqParam context.Context) ([]blog.BlogPostMeta, error) {
-// 				panic("mock out the GetBlogPostsMeta method")
-// 			},
-// 		}
+//		// make and configure a mocked blog.BlogStore
+//		mockedBlogStore := &MockBlogStore{
+//			GetBlogPostFunc: func(contextMoqParam context.Context, s string) (blog.BlogPost, error) {
+//				panic("mock out the GetBlogPost method")
+//			},
+//			GetBlogPostsMetaFunc: func(contextMoqParam context.Context) ([]blog.BlogPostMeta, error) {
+//				panic("mock out the GetBlogPostsMeta method")
+//			},
+//			GetBlogPostsPageFunc: func(contextMoqParam context.Context, listOptions blog.ListOptions) (blog.BlogPostsPage, error) {
+//				panic("mock out the GetBlogPostsPage method")
+//			},
+//		}
 //
-// 		// use mockedBlogStore in code that requires blog.BlogStore
-// 		// and then make assertions.
+//		// use mockedBlogStore in code that requires blog.BlogStore
+//		// and then make assertions.
 //
-// 	}
+//	}
 type MockBlogStore struct {
 	// GetBlogPostFunc mocks the GetBlogPost method.
 	GetBlogPostFunc func(contextMoqParam context.Context, s string) (blog.BlogPost, error)
@@ -38,6 +41,9 @@ type MockBlogStore struct {
 	// GetBlogPostsMetaFunc mocks the GetBlogPostsMeta method.
 	GetBlogPostsMetaFunc func(contextMoqParam context.Context) ([]blog.BlogPostMeta, error)
 
+	// GetBlogPostsPageFunc mocks the GetBlogPostsPage method.
+	GetBlogPostsPageFunc func(contextMoqParam context.Context, listOptions blog.ListOptions) (blog.BlogPostsPage, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// GetBlogPost holds details about calls to the GetBlogPost method.
@@ -52,9 +58,17 @@ type MockBlogStore struct {
 			// ContextMoqParam is the contextMoqParam argument value.
 			ContextMoqParam context.Context
 		}
+		// GetBlogPostsPage holds details about calls to the GetBlogPostsPage method.
+		GetBlogPostsPage []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// ListOptions is the listOptions argument value.
+			ListOptions blog.ListOptions
+		}
 	}
 	lockGetBlogPost      sync.RWMutex
 	lockGetBlogPostsMeta sync.RWMutex
+	lockGetBlogPostsPage sync.RWMutex
 }
 
 // GetBlogPost calls GetBlogPostFunc.
@@ -77,7 +91,8 @@ func (mock *MockBlogStore) GetBlogPost(contextMoqParam context.Context, s string
 
 // GetBlogPostCalls gets all the calls that were made to GetBlogPost.
 // Check the length with:
-//     len(mockedBlogStore.GetBlogPostCalls())
+//
+//	len(mockedBlogStore.GetBlogPostCalls())
 func (mock *MockBlogStore) GetBlogPostCalls() []struct {
 	ContextMoqParam context.Context
 	S               string
@@ -110,7 +125,8 @@ func (mock *MockBlogStore) GetBlogPostsMeta(contextMoqParam context.Context) ([]
 
 // GetBlogPostsMetaCalls gets all the calls that were made to GetBlogPostsMeta.
 // Check the length with:
-//     len(mockedBlogStore.GetBlogPostsMetaCalls())
+//
+//	len(mockedBlogStore.GetBlogPostsMetaCalls())
 func (mock *MockBlogStore) GetBlogPostsMetaCalls() []struct {
 	ContextMoqParam context.Context
 } {
@@ -122,3 +138,39 @@ func (mock *MockBlogStore) GetBlogPostsMetaCalls() []struct {
 	mock.lockGetBlogPostsMeta.RUnlock()
 	return calls
 }
+
+// GetBlogPostsPage calls GetBlogPostsPageFunc.
+func (mock *MockBlogStore) GetBlogPostsPage(contextMoqParam context.Context, listOptions blog.ListOptions) (blog.BlogPostsPage, error) {
+	if mock.GetBlogPostsPageFunc == nil {
+		panic("MockBlogStore.GetBlogPostsPageFunc: method is nil but BlogStore.GetBlogPostsPage was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		ListOptions     blog.ListOptions
+	}{
+		ContextMoqParam: contextMoqParam,
+		ListOptions:     listOptions,
+	}
+	mock.lockGetBlogPostsPage.Lock()
+	mock.calls.GetBlogPostsPage = append(mock.calls.GetBlogPostsPage, callInfo)
+	mock.lockGetBlogPostsPage.Unlock()
+	return mock.GetBlogPostsPageFunc(contextMoqParam, listOptions)
+}
+
+// GetBlogPostsPageCalls gets all the calls that were made to GetBlogPostsPage.
+// Check the length with:
+//
+//	len(mockedBlogStore.GetBlogPostsPageCalls())
+func (mock *MockBlogStore) GetBlogPostsPageCalls() []struct {
+	ContextMoqParam context.Context
+	ListOptions     blog.ListOptions
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		ListOptions     blog.ListOptions
+	}
+	mock.lockGetBlogPostsPage.RLock()
+	calls = mock.calls.GetBlogPostsPage
+	mock.lockGetBlogPostsPage.RUnlock()
+	return calls
+}
@@ -2,21 +2,27 @@ package servers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/cache"
+	"github.com/zaker/anachrome-be/stores/search"
 
 	"github.com/zaker/anachrome-be/controllers"
 	"github.com/zaker/anachrome-be/middleware"
 	"github.com/zaker/anachrome-be/services"
 
 	"github.com/labstack/echo/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	ec_middleware "github.com/labstack/echo/v5/middleware"
 )
@@ -25,12 +31,37 @@ type APIServer struct {
 	serv     Services
 	app      *echo.Echo
 	wc       WebConfig
+	feed     FeedConfig
+	robots   string
+	webhook  DropboxWebhookConfig
 	version  string
 	hostAddr string
+
+	updates      <-chan string
+	invalidators []invalidator
+	oauth2       *OAuth2Option
+	metrics      bool
+	healthChecks map[string]controllers.HealthCheck
 }
 
 type Services struct {
-	blogStore blog.BlogStore
+	blogStore  blog.BlogStore
+	assetStore blog.AssetStore
+	imageCache cache.BlobCache
+	drafts     blog.BlogStore
+	syncer     Resyncer
+	previews   *services.PreviewSigner
+	markdown   *services.Markdown
+}
+
+// Resyncer reads the whole backend of the blog store again, not only its changes
+type Resyncer interface {
+	Resync()
+}
+
+// invalidator is a cache derived from the blog store that is told about changed posts
+type invalidator interface {
+	Invalidate(context.Context, string) error
 }
 type WebConfig struct {
 	echo.StartConfig
@@ -40,6 +71,22 @@ type WebConfig struct {
 	devMode   bool
 }
 
+type FeedConfig struct {
+	Title string
+	Limit int
+}
+
+type DropboxWebhookConfig struct {
+	AppSecret string
+	Syncer    controllers.DropboxSyncer
+}
+
+// Scopes admin API tokens are granted
+const (
+	scopeCacheRead  = "cache:read"
+	scopeCacheWrite = "cache:write"
+)
+
 type Option interface {
 	apply(*APIServer) error
 }
@@ -62,13 +109,23 @@ func NewHTTPServer(opts ...Option) (hs *APIServer, err error) {
 	}
 	hs.app.Pre(ec_middleware.RemoveTrailingSlash())
 
+	hs.app.Logger = slog.Default()
+	hs.app.Use(middleware.RequestID())
+	hs.app.Use(middleware.Tracing())
+	if hs.metrics {
+		hs.app.Use(middleware.Metrics())
+	}
+	hs.app.Use(middleware.AccessLog(hs.app.Logger))
+
 	hs.app.Use(ec_middleware.BodyLimit(2_000_000))
 	if !hs.wc.devMode {
 
 		hs.app.Use(ec_middleware.CSRFWithConfig(ec_middleware.CSRFConfig{
 			Skipper: func(ctx *echo.Context) bool {
 
-				return ctx.Path() == "/gql"
+				// The admin API authenticates with bearer tokens, not cookies
+				return ctx.Path() == "/gql" || ctx.Path() == "/dropbox/webhook" ||
+					strings.HasPrefix(ctx.Path(), "/admin/")
 
 			},
 			TokenLookup:    "header:X-XSRF-TOKEN",
@@ -80,7 +137,9 @@ func NewHTTPServer(opts ...Option) (hs *APIServer, err error) {
 	hs.app.Use(ec_middleware.CORSWithConfig(ec_middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization,
+			"traceparent", "tracestate", echo.HeaderXRequestID},
+		ExposeHeaders: []string{echo.HeaderXRequestID},
 	}))
 
 	hs.app.Use(ec_middleware.Secure())
@@ -88,7 +147,6 @@ func NewHTTPServer(opts ...Option) (hs *APIServer, err error) {
 		Level: 5,
 	}))
 	hs.app.Use(ec_middleware.Recover())
-	hs.app.Logger = slog.Default()
 	hs.app.Use(middleware.MIME())
 	if !hs.wc.devMode {
 
@@ -103,13 +161,99 @@ func (as *APIServer) registerEndpoints() error {
 
 	// Blog
 
-	blogCotroller := controllers.NewBlog(as.serv.blogStore, as.wc.HostName)
+	markdown := as.serv.markdown
+	if markdown == nil {
+		var err error
+		markdown, err = services.NewMarkdown(services.DefaultHighlightStyle)
+		if err != nil {
+			return err
+		}
+	}
+	blogCotroller := controllers.NewBlog(as.serv.blogStore, markdown, as.wc.HostName)
 	as.app.GET("/blog", blogCotroller.ListBlogPosts)
 	as.app.GET("/blog/:id", blogCotroller.GetBlogPost)
+	as.app.GET("/highlight.css", blogCotroller.HighlightStyle)
+	as.app.GET("/tags", blogCotroller.ListTags)
+	as.app.GET("/tags/:tag", blogCotroller.ListTaggedBlogPosts)
+
+	if as.serv.previews != nil {
+		previewController := controllers.NewPreview(as.serv.drafts, as.serv.previews, markdown, as.wc.HostName)
+		as.app.GET("/blog/:id/preview", previewController.GetPreview)
+	}
+
+	if as.serv.assetStore != nil {
+		assetController := controllers.NewAsset(as.serv.assetStore, as.serv.imageCache)
+		as.app.GET("/blog/:id/assets/*", assetController.GetAsset)
+	}
+
+	// Feeds
+
+	feedController := controllers.NewFeed(as.serv.blogStore, markdown, as.wc.HostName, as.feed.Title, as.feed.Limit)
+	as.app.GET("/feed.atom", feedController.Atom)
+	as.app.GET("/feed.rss", feedController.RSS)
+	as.app.GET("/feed.json", feedController.JSON)
+
+	// Sitemap
+
+	sitemapController := controllers.NewSitemap(as.serv.blogStore, as.wc.HostName, as.robots)
+	as.app.GET("/sitemap.xml", sitemapController.SitemapXML)
+	as.app.GET("/robots.txt", sitemapController.RobotsTXT)
+	as.invalidators = append(as.invalidators, sitemapController)
+
+	// Search
+
+	searchIndex := search.NewIndex(as.serv.blogStore)
+	go func() {
+		err := searchIndex.Rebuild(context.Background())
+		if err != nil {
+			as.app.Logger.Warn("building search index", slog.Any("err", err))
+		}
+	}()
+	searchController := controllers.NewSearch(searchIndex, as.wc.HostName)
+	as.app.GET("/search", searchController.Search)
+	as.invalidators = append(as.invalidators, searchIndex)
+
+	// Dropbox webhook
+
+	if as.webhook.Syncer != nil {
+		webhookController := controllers.NewDropboxWebhook(as.webhook.AppSecret, as.webhook.Syncer)
+		as.app.GET("/dropbox/webhook", webhookController.Challenge)
+		as.app.POST("/dropbox/webhook", webhookController.Notify)
+	}
+
+	// Admin
+
+	if as.oauth2 != nil {
+		admin := as.app.Group("/admin", middleware.JWT(as.oauth2.jwtConfig()))
+		cachedStore, _ := as.serv.blogStore.(cache.CachedBlogStore)
+		adminController := controllers.NewAdmin(cachedStore, as.invalidate, func(ctx context.Context) error {
+			return as.resync(ctx, sitemapController, searchIndex)
+		})
+		admin.GET("/whoami", adminController.WhoAmI)
+		if cachedStore != nil {
+			admin.GET("/cache", adminController.CacheEntries, middleware.RequireScopes(scopeCacheRead))
+			admin.DELETE("/cache", adminController.FlushCache, middleware.RequireScopes(scopeCacheWrite))
+			admin.DELETE("/cache/posts/:id", adminController.InvalidatePost, middleware.RequireScopes(scopeCacheWrite))
+		}
+		admin.POST("/resync", adminController.Resync, middleware.RequireScopes(scopeCacheWrite))
+	}
+
+	// Health
+
+	healthController := controllers.NewHealth(as.healthChecks)
+	as.app.GET("/healthz", healthController.Live)
+	as.app.GET("/readyz", healthController.Ready)
+
+	// Metrics
+
+	if as.metrics {
+		// Compressed by the gzip middleware
+		as.app.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{DisableCompression: true})))
+	}
 
 	// GQL
 	if as.wc.enableGQL {
-		gql, err := services.InitGQL(as.wc.devMode, as.serv.blogStore)
+		gql, err := services.InitGQL(as.wc.devMode, as.serv.blogStore, markdown, searchIndex)
 		if err != nil {
 			return err
 		}
@@ -121,12 +265,55 @@ func (as *APIServer) registerEndpoints() error {
 	return nil
 }
 
+// watchUpdates invalidates the blog store cache and derived caches as posts change
+func (as *APIServer) watchUpdates() {
+
+	for id := range as.updates {
+		err := as.invalidate(context.Background(), id)
+		if err != nil {
+			as.app.Logger.Warn("invalidating", slog.String("id", id), slog.Any("err", err))
+		}
+	}
+}
+
+// invalidate tells the blog store cache, and then the caches derived from it, that the post changed
+func (as *APIServer) invalidate(ctx context.Context, id string) error {
+
+	invalidators := as.invalidators
+	if bs, ok := as.serv.blogStore.(invalidator); ok {
+		invalidators = append([]invalidator{bs}, invalidators...)
+	}
+	var errs []error
+	for _, inv := range invalidators {
+		errs = append(errs, inv.Invalidate(ctx, id))
+	}
+	return errors.Join(errs...)
+}
+
+// resync flushes the blog store cache, asks the store to read its backend again and rebuilds the derived caches
+func (as *APIServer) resync(ctx context.Context, sitemap *controllers.Sitemap, searchIndex *search.Index) error {
+
+	if bs, ok := as.serv.blogStore.(cache.CachedBlogStore); ok {
+		err := bs.Flush(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if as.serv.syncer != nil {
+		as.serv.syncer.Resync()
+	}
+	return errors.Join(sitemap.Regenerate(ctx), searchIndex.Rebuild(ctx))
+}
+
 func (as *APIServer) Serve() error {
 
 	err := as.registerEndpoints()
 	if err != nil {
 		return err
 	}
+	if as.updates != nil {
+		go as.watchUpdates()
+	}
 	wc := as.wc
 
 	wc.StartConfig = echo.StartConfig{
@@ -134,7 +321,11 @@ func (as *APIServer) Serve() error {
 		GracefulTimeout: 1 * time.Second,
 		HideBanner:      true,
 	}
-	as.app.Logger.Log(context.Background(), slog.LevelInfo, "webConfig", slog.Any("wc", wc))
+	as.app.Logger.Info("webConfig",
+		slog.String("hostName", wc.HostName),
+		slog.String("address", wc.Address),
+		slog.Bool("devMode", wc.devMode),
+		slog.Bool("gql", wc.enableGQL))
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM) // start shutdown process on ctrl+c
 	defer cancel()
@@ -192,3 +383,126 @@ func WithBlogStore(blogStore blog.BlogStore) Option {
 		return
 	})
 }
+
+// WithAssets serves the images and attachments posts link to
+func WithAssets(assetStore blog.AssetStore) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.serv.assetStore = assetStore
+		return
+	})
+}
+
+// WithPreviews shows drafts and scheduled posts of the drafts store through links signed with the secret
+func WithPreviews(drafts blog.BlogStore, secret string) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.serv.drafts = drafts
+		as.serv.previews = services.NewPreviewSigner(secret)
+		return
+	})
+}
+
+// WithSyncer has resyncs ask the blog store to read its whole backend again
+func WithSyncer(syncer Resyncer) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.serv.syncer = syncer
+		return
+	})
+}
+
+// WithImageCache keeps resized images in a cache shared with the blog store
+func WithImageCache(images cache.BlobCache) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.serv.imageCache = images
+		return
+	})
+}
+
+func WithMarkdown(markdown *services.Markdown) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.serv.markdown = markdown
+		return
+	})
+}
+
+func WithFeed(fc FeedConfig) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.feed = fc
+		return
+	})
+}
+
+// WithUpdates invalidates caches for the post IDs received on updates
+func WithUpdates(updates <-chan string) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.updates = updates
+		return
+	})
+}
+
+func WithRobots(rules string) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		as.robots = rules
+		return
+	})
+}
+
+// WithMetrics serves Prometheus metrics of the requests, caches and stores, and of the collectors
+func WithMetrics(collectors ...prometheus.Collector) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		for _, c := range collectors {
+			err = prometheus.Register(c)
+			if are := (prometheus.AlreadyRegisteredError{}); errors.As(err, &are) {
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("registering metrics: %w", err)
+			}
+		}
+		as.metrics = true
+		return
+	})
+}
+
+// WithHealthCheck makes the server ready only while the check passes
+func WithHealthCheck(name string, check controllers.HealthCheck) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		if as.healthChecks == nil {
+			as.healthChecks = make(map[string]controllers.HealthCheck)
+		}
+		as.healthChecks[name] = check
+		return
+	})
+}
+
+// WithDropboxWebhook syncs the Dropbox folder when notifications signed with the app secret arrive
+func WithDropboxWebhook(wc DropboxWebhookConfig) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		if len(wc.AppSecret) == 0 {
+			return fmt.Errorf("dropbox webhook needs the app secret")
+		}
+		as.webhook = wc
+		return
+	})
+}
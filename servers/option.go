@@ -1,6 +1,11 @@
 package servers
 
-import "net/url"
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/zaker/anachrome-be/middleware"
+)
 
 type EmptyOption struct{}
 
@@ -27,3 +32,34 @@ type OAuth2Option struct {
 	Issuer     string
 	ApiSecret  []byte
 }
+
+// jwtConfig validates tokens signed with the API secret, or by the keys the auth server publishes
+func (o OAuth2Option) jwtConfig() middleware.JWTConfig {
+
+	config := middleware.JWTConfig{
+		Secret:   o.ApiSecret,
+		Audience: o.Audience,
+		Issuer:   o.Issuer,
+	}
+	if o.AuthServer != nil {
+		config.JWKSURL = o.AuthServer.JoinPath(".well-known", "jwks.json").String()
+	}
+	return config
+}
+
+// WithOAuth2 serves the admin API to bearers of tokens for the audience, from the issuer
+func WithOAuth2(o OAuth2Option) Option {
+
+	return newFuncOption(func(as *APIServer) (err error) {
+
+		if len(o.ApiSecret) == 0 && o.AuthServer == nil {
+			return fmt.Errorf("oauth2 needs an api secret or an auth server")
+		}
+		// The auth server signs tokens for other APIs too, they are told apart by audience and issuer
+		if o.AuthServer != nil && (len(o.Audience) == 0 || len(o.Issuer) == 0) {
+			return fmt.Errorf("oauth2 with an auth server needs an audience and an issuer")
+		}
+		as.oauth2 = &o
+		return
+	})
+}
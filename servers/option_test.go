@@ -0,0 +1,30 @@
+package servers
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestWithOAuth2(t *testing.T) {
+
+	authServer, _ := url.Parse("https://auth.example.com/")
+	tests := []struct {
+		name    string
+		o       OAuth2Option
+		wantErr bool
+	}{
+		{"Api secret", OAuth2Option{ApiSecret: []byte("secret")}, false},
+		{"Auth server", OAuth2Option{AuthServer: authServer, Audience: "anachrome", Issuer: "https://auth.example.com/"}, false},
+		{"Nothing to verify tokens with", OAuth2Option{Audience: "anachrome"}, true},
+		{"Auth server without audience", OAuth2Option{AuthServer: authServer, Issuer: "https://auth.example.com/"}, true},
+		{"Auth server without issuer", OAuth2Option{AuthServer: authServer, Audience: "anachrome"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithOAuth2(tt.o).apply(&APIServer{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WithOAuth2() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Feed is the blog as a syndication feed, rendered as Atom, RSS or JSON Feed
+type Feed struct {
+	Title   string
+	Link    string
+	Updated time.Time
+	Entries []FeedEntry
+}
+
+// FeedEntry is a single post in a feed
+type FeedEntry struct {
+	Title       string
+	Link        string
+	Published   time.Time
+	Updated     time.Time
+	ContentHTML string
+}
+
+// BlogPostPath is the absolute link to a post
+func BlogPostPath(basePath, id string) string {
+	return basePath + "/blog/" + id
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string    `xml:"title"`
+	ID        string    `xml:"id"`
+	Link      atomLink  `xml:"link"`
+	Published string    `xml:"published,omitempty"`
+	Updated   string    `xml:"updated"`
+	Content   *atomText `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// Atom renders the feed as an RFC 4287 Atom document
+func (f Feed) Atom() ([]byte, error) {
+
+	af := atomFeed{
+		Title:   f.Title,
+		ID:      f.Link + "/",
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Link + "/feed.atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link + "/blog", Rel: "alternate", Type: "text/html"},
+		},
+		Author:  atomPerson{Name: f.Title},
+		Entries: make([]atomEntry, 0, len(f.Entries)),
+	}
+	for _, ent := range f.Entries {
+		ae := atomEntry{
+			Title:   ent.Title,
+			ID:      ent.Link,
+			Link:    atomLink{Href: ent.Link, Rel: "alternate", Type: "text/html"},
+			Updated: ent.Updated.UTC().Format(time.RFC3339),
+		}
+		if !ent.Published.IsZero() {
+			ae.Published = ent.Published.UTC().Format(time.RFC3339)
+		}
+		if len(ent.ContentHTML) > 0 {
+			ae.Content = &atomText{Type: "html", Body: ent.ContentHTML}
+		}
+		af.Entries = append(af.Entries, ae)
+	}
+
+	return marshalXML(af)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	AtomLink      atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// RSS renders the feed as an RSS 2.0 document
+func (f Feed) RSS() ([]byte, error) {
+
+	rf := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link + "/blog",
+			Description:   f.Title,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			AtomLink:      atomLink{Href: f.Link + "/feed.rss", Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssItem, 0, len(f.Entries)),
+		},
+	}
+	for _, ent := range f.Entries {
+		ri := rssItem{
+			Title:       ent.Title,
+			Link:        ent.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: ent.Link},
+			Description: ent.ContentHTML,
+		}
+		if !ent.Published.IsZero() {
+			ri.PubDate = ent.Published.UTC().Format(time.RFC1123Z)
+		}
+		rf.Channel.Items = append(rf.Channel.Items, ri)
+	}
+
+	return marshalXML(rf)
+}
+
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	ContentHTML   string `json:"content_html"`
+	DatePublished string `json:"date_published,omitempty"`
+	DateModified  string `json:"date_modified,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+// JSON renders the feed as a JSON Feed 1.1 document
+func (f Feed) JSON() ([]byte, error) {
+
+	jf := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link + "/blog",
+		FeedURL:     f.Link + "/feed.json",
+		Items:       make([]jsonFeedItem, 0, len(f.Entries)),
+	}
+	for _, ent := range f.Entries {
+		ji := jsonFeedItem{
+			ID:          ent.Link,
+			URL:         ent.Link,
+			Title:       ent.Title,
+			ContentHTML: ent.ContentHTML,
+		}
+		if !ent.Published.IsZero() {
+			ji.DatePublished = ent.Published.UTC().Format(time.RFC3339)
+		}
+		if !ent.Updated.IsZero() {
+			ji.DateModified = ent.Updated.UTC().Format(time.RFC3339)
+		}
+		jf.Items = append(jf.Items, ji)
+	}
+
+	b, err := json.Marshal(jf)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling json feed: %w", err)
+	}
+	return b, nil
+}
+
+func marshalXML(v any) ([]byte, error) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling xml: %w", err)
+	}
+	return append([]byte(xml.Header), b...), nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFeed = Feed{
+	Title:   "Anachrome",
+	Link:    "https://example.com",
+	Updated: time.Date(2021, 3, 19, 10, 0, 0, 0, time.UTC),
+	Entries: []FeedEntry{
+		{
+			Title:       "Foo & friends",
+			Link:        "https://example.com/blog/foo",
+			Published:   time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC),
+			Updated:     time.Date(2021, 3, 19, 10, 0, 0, 0, time.UTC),
+			ContentHTML: "<p>Foo text</p>",
+		},
+	},
+}
+
+func TestFeed_Atom(t *testing.T) {
+
+	got, err := testFeed.Atom()
+	if err != nil {
+		t.Fatalf("Feed.Atom() error = %v", err)
+	}
+	out := string(got)
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<updated>2021-03-19T10:00:00Z</updated>`,
+		`<link href="https://example.com/feed.atom" rel="self" type="application/atom+xml"></link>`,
+		`<title>Foo &amp; friends</title>`,
+		`<id>https://example.com/blog/foo</id>`,
+		`<published>2021-03-18T10:27:00Z</published>`,
+		`<content type="html">&lt;p&gt;Foo text&lt;/p&gt;</content>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Feed.Atom() = %s, missing %s", out, want)
+		}
+	}
+	assert.NoError(t, xml.Unmarshal(got, &struct{}{}))
+}
+
+func TestFeed_RSS(t *testing.T) {
+
+	got, err := testFeed.RSS()
+	if err != nil {
+		t.Fatalf("Feed.RSS() error = %v", err)
+	}
+	out := string(got)
+	for _, want := range []string{
+		`<rss version="2.0">`,
+		`<lastBuildDate>Fri, 19 Mar 2021 10:00:00 +0000</lastBuildDate>`,
+		`<guid isPermaLink="true">https://example.com/blog/foo</guid>`,
+		`<pubDate>Thu, 18 Mar 2021 10:27:00 +0000</pubDate>`,
+		`<description>&lt;p&gt;Foo text&lt;/p&gt;</description>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Feed.RSS() = %s, missing %s", out, want)
+		}
+	}
+	assert.NoError(t, xml.Unmarshal(got, &struct{}{}))
+}
+
+func TestFeed_JSON(t *testing.T) {
+
+	got, err := testFeed.JSON()
+	if err != nil {
+		t.Fatalf("Feed.JSON() error = %v", err)
+	}
+	var jf map[string]any
+	err = json.Unmarshal(got, &jf)
+	if err != nil {
+		t.Fatalf("Feed.JSON() is not json: %v", err)
+	}
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", jf["version"])
+	assert.Equal(t, "https://example.com/feed.json", jf["feed_url"])
+	assert.Equal(t, []any{map[string]any{
+		"id":             "https://example.com/blog/foo",
+		"url":            "https://example.com/blog/foo",
+		"title":          "Foo & friends",
+		"content_html":   "<p>Foo text</p>",
+		"date_published": "2021-03-18T10:27:00Z",
+		"date_modified":  "2021-03-19T10:00:00Z",
+	}}, jf["items"])
+}
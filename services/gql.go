@@ -1,18 +1,23 @@
 package services
 
 import (
-	"context"
+	"fmt"
+	"time"
 
 	"github.com/graphql-go/graphql"
 	"github.com/graphql-go/handler"
+	"go.opentelemetry.io/otel/codes"
 
 	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/search"
 )
 
 // GQL graphql setup for anachro.me
 type GQL struct {
-	conf      handler.Config
-	blogStore blog.BlogStore
+	conf        handler.Config
+	blogStore   blog.BlogStore
+	markdown    *Markdown
+	searchIndex *search.Index
 }
 
 func getBlogMetaType() *graphql.Object {
@@ -36,6 +41,18 @@ func getBlogMetaType() *graphql.Object {
 				Type:        graphql.DateTime,
 				Description: "The date last updated.",
 			},
+			"tags": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: "The tags of the post.",
+			},
+			"categories": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: "The categories of the post.",
+			},
+			"summary": &graphql.Field{
+				Type:        graphql.String,
+				Description: "A short summary of the post.",
+			},
 		},
 		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
 
@@ -86,6 +103,36 @@ func getBlogMetaType() *graphql.Object {
 					return nil, nil
 				},
 			},
+			"tags": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: "The tags of the post.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if meta, ok := p.Source.(blog.BlogPostMeta); ok {
+						return meta.Tags, nil
+					}
+					return nil, nil
+				},
+			},
+			"categories": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: "The categories of the post.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if meta, ok := p.Source.(blog.BlogPostMeta); ok {
+						return meta.Categories, nil
+					}
+					return nil, nil
+				},
+			},
+			"summary": &graphql.Field{
+				Type:        graphql.String,
+				Description: "A short summary of the post.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if meta, ok := p.Source.(blog.BlogPostMeta); ok {
+						return meta.Summary, nil
+					}
+					return nil, nil
+				},
+			},
 		},
 		Interfaces: []*graphql.Interface{
 			blogInterface,
@@ -95,12 +142,157 @@ func getBlogMetaType() *graphql.Object {
 	return blogPostMetaType
 }
 
+type blogConnection struct {
+	page        blog.BlogPostsPage
+	hasPrevious bool
+}
+
+type blogEdge struct {
+	cursor string
+	node   blog.BlogPostMeta
+}
+
+// getBlogConnectionType is a Relay style connection of posts
+func getBlogConnectionType(blogMetaType *graphql.Object) *graphql.Object {
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "PageInfo",
+		Description: "Information about paging through a connection",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if conn, ok := p.Source.(blogConnection); ok {
+						return conn.page.HasNextPage, nil
+					}
+					return false, nil
+				},
+			},
+			"hasPreviousPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if conn, ok := p.Source.(blogConnection); ok {
+						return conn.hasPrevious, nil
+					}
+					return false, nil
+				},
+			},
+			"startCursor": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if conn, ok := p.Source.(blogConnection); ok && len(conn.page.Cursors) > 0 {
+						return conn.page.Cursors[0], nil
+					}
+					return nil, nil
+				},
+			},
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if conn, ok := p.Source.(blogConnection); ok && len(conn.page.Cursors) > 0 {
+						return conn.page.EndCursor(), nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "BlogPostEdge",
+		Description: "A post in a connection",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if edge, ok := p.Source.(blogEdge); ok {
+						return edge.cursor, nil
+					}
+					return nil, nil
+				},
+			},
+			"node": &graphql.Field{
+				Type: graphql.NewNonNull(blogMetaType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if edge, ok := p.Source.(blogEdge); ok {
+						return edge.node, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name:        "BlogPostConnection",
+		Description: "A page of posts",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					conn, ok := p.Source.(blogConnection)
+					if !ok {
+						return nil, nil
+					}
+					edges := make([]blogEdge, 0, len(conn.page.Posts))
+					for i, meta := range conn.page.Posts {
+						edges = append(edges, blogEdge{cursor: conn.page.Cursors[i], node: meta})
+					}
+					return edges, nil
+				},
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+			"totalCount": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "The number of posts matching the filters on all pages.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if conn, ok := p.Source.(blogConnection); ok {
+						return conn.page.TotalCount, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+}
+
 // InitGQL initializes components
-func InitGQL(isDevMode bool, blogStore blog.BlogStore) (*GQL, error) {
+func InitGQL(isDevMode bool, blogStore blog.BlogStore, markdown *Markdown, searchIndex *search.Index) (*GQL, error) {
 
-	gql := &GQL{blogStore: blogStore}
+	gql := &GQL{blogStore: blogStore, markdown: markdown, searchIndex: searchIndex}
 
 	blogMetaType := getBlogMetaType()
+	tagType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Tag",
+		Description: "A tag with the number of posts using it",
+		Fields: graphql.Fields{
+			"tag": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "The tag.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if tc, ok := p.Source.(blog.TagCount); ok {
+						return tc.Tag, nil
+					}
+					return nil, nil
+				},
+			},
+			"count": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "The number of posts with the tag.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if tc, ok := p.Source.(blog.TagCount); ok {
+						return tc.Count, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
 	blogType := graphql.NewObject(graphql.ObjectConfig{
 		Name:        "BlogPost",
 		Description: "A blob with some textual content",
@@ -125,8 +317,76 @@ func InitGQL(isDevMode bool, blogStore blog.BlogStore) (*GQL, error) {
 					return nil, nil
 				},
 			},
+			"contentHTML": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The content rendered as sanitized HTML.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if blog, ok := p.Source.(blog.BlogPost); ok {
+						if len(blog.ContentHTML) > 0 {
+							return blog.ContentHTML, nil
+						}
+						return gql.markdown.RenderPost(p.Context, blog.Content, AssetPath("", blog.Meta.ID))
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+	searchResultType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "SearchResult",
+		Description: "A post matching a search",
+		Fields: graphql.Fields{
+			"meta": &graphql.Field{
+				Type:        graphql.NewNonNull(blogMetaType),
+				Description: "The blog post metadata.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if res, ok := p.Source.(search.Result); ok {
+						return res.Meta, nil
+					}
+					return nil, nil
+				},
+			},
+			"score": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Float),
+				Description: "How well the post matches, higher is better.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if res, ok := p.Source.(search.Result); ok {
+						return res.Score, nil
+					}
+					return nil, nil
+				},
+			},
+			"snippet": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Content around the match as HTML with matches in <mark>.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if res, ok := p.Source.(search.Result); ok {
+						return res.Snippet, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+	sortType := graphql.NewEnum(graphql.EnumConfig{
+		Name:        "BlogPostSort",
+		Description: "The order of listed posts",
+		Values: graphql.EnumValueConfigMap{
+			"PUBLISHED": &graphql.EnumValueConfig{
+				Value:       blog.SortPublished,
+				Description: "Most recently published first.",
+			},
+			"UPDATED": &graphql.EnumValueConfig{
+				Value:       blog.SortUpdated,
+				Description: "Most recently updated first.",
+			},
+			"TITLE": &graphql.EnumValueConfig{
+				Value:       blog.SortTitle,
+				Description: "Alphabetically by title.",
+			},
 		},
 	})
+	connectionType := getBlogConnectionType(blogMetaType)
 	// Schema
 	fields := graphql.Fields{
 		"hello": &graphql.Field{
@@ -136,13 +396,112 @@ func InitGQL(isDevMode bool, blogStore blog.BlogStore) (*GQL, error) {
 			},
 		},
 		"blogs": &graphql.Field{
-			Type: graphql.NewList(blogMetaType),
+			Type:              graphql.NewList(blogMetaType),
+			Description:       "Every post, most recently published first.",
+			DeprecationReason: "Use blogsConnection, which lists posts a page at a time.",
+			Args: graphql.FieldConfigArgument{
+				"tag": &graphql.ArgumentConfig{
+					Description: "only posts with this tag",
+					Type:        graphql.String,
+				},
+				"category": &graphql.ArgumentConfig{
+					Description: "only posts in this category",
+					Type:        graphql.String,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				opts := blog.ListOptions{Sort: blog.SortPublished}
+				opts.Tag, _ = p.Args["tag"].(string)
+				opts.Category, _ = p.Args["category"].(string)
+				page, err := gql.blogStore.GetBlogPostsPage(p.Context, opts)
+				if err != nil {
+					return nil, err
+				}
+				return page.Posts, nil
+			},
+		},
+
+		"blogsConnection": &graphql.Field{
+			Type:        graphql.NewNonNull(connectionType),
+			Description: "A page of posts.",
+			Args: graphql.FieldConfigArgument{
+				"first": &graphql.ArgumentConfig{
+					Description:  "page size up to 100",
+					Type:         graphql.Int,
+					DefaultValue: blog.DefaultPageSize,
+				},
+				"after": &graphql.ArgumentConfig{
+					Description: "cursor of the post before the page",
+					Type:        graphql.String,
+				},
+				"sort": &graphql.ArgumentConfig{
+					Type:         sortType,
+					DefaultValue: blog.SortPublished,
+				},
+				"since": &graphql.ArgumentConfig{
+					Description: "only posts published at or after this time",
+					Type:        graphql.DateTime,
+				},
+				"until": &graphql.ArgumentConfig{
+					Description: "only posts published before this time",
+					Type:        graphql.DateTime,
+				},
+				"tag": &graphql.ArgumentConfig{
+					Description: "only posts with this tag",
+					Type:        graphql.String,
+				},
+				"category": &graphql.ArgumentConfig{
+					Description: "only posts in this category",
+					Type:        graphql.String,
+				},
+			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				posts, err := gql.blogStore.GetBlogPostsMeta(context.TODO())
+				opts := blog.ListOptions{}
+				opts.First, _ = p.Args["first"].(int)
+				if opts.First < 1 || opts.First > blog.MaxPageSize {
+					return nil, fmt.Errorf("first must be between 1 and %d", blog.MaxPageSize)
+				}
+				opts.After, _ = p.Args["after"].(string)
+				opts.Sort, _ = p.Args["sort"].(blog.SortOrder)
+				opts.Since, _ = p.Args["since"].(time.Time)
+				opts.Until, _ = p.Args["until"].(time.Time)
+				opts.Tag, _ = p.Args["tag"].(string)
+				opts.Category, _ = p.Args["category"].(string)
+
+				page, err := gql.blogStore.GetBlogPostsPage(p.Context, opts)
 				if err != nil {
 					return nil, err
 				}
-				return posts, nil
+				return blogConnection{page: page, hasPrevious: len(opts.After) > 0}, nil
+			},
+		},
+
+		"tags": &graphql.Field{
+			Type: graphql.NewList(tagType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				posts, err := gql.blogStore.GetBlogPostsMeta(p.Context)
+				if err != nil {
+					return nil, err
+				}
+				return blog.CountTags(posts), nil
+			},
+		},
+
+		"search": &graphql.Field{
+			Type: graphql.NewList(searchResultType),
+			Args: graphql.FieldConfigArgument{
+				"query": &graphql.ArgumentConfig{
+					Description: `words to search for, "quoted words" for phrases and word* for prefixes`,
+					Type:        graphql.NewNonNull(graphql.String),
+				},
+				"limit": &graphql.ArgumentConfig{
+					Description:  "maximum number of results",
+					Type:         graphql.Int,
+					DefaultValue: 20,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return gql.searchIndex.Search(p.Args["query"].(string), p.Args["limit"].(int)), nil
 			},
 		},
 
@@ -155,7 +514,7 @@ func InitGQL(isDevMode bool, blogStore blog.BlogStore) (*GQL, error) {
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-				post, err := gql.blogStore.GetBlogPost(context.TODO(), p.Args["id"].(string))
+				post, err := gql.blogStore.GetBlogPost(p.Context, p.Args["id"].(string))
 				if err != nil {
 					return nil, err
 				}
@@ -163,6 +522,9 @@ func InitGQL(isDevMode bool, blogStore blog.BlogStore) (*GQL, error) {
 			},
 		},
 	}
+	for name, field := range fields {
+		field.Resolve = traceResolver("RootQuery."+name, field.Resolve)
+	}
 	rootQuery := graphql.ObjectConfig{Name: "RootQuery", Fields: fields}
 	schemaConfig := graphql.SchemaConfig{Query: graphql.NewObject(rootQuery)}
 	schema, err := graphql.NewSchema(schemaConfig)
@@ -181,3 +543,19 @@ func InitGQL(isDevMode bool, blogStore blog.BlogStore) (*GQL, error) {
 func (gql *GQL) Conf() *handler.Config {
 	return &gql.conf
 }
+
+// traceResolver resolves the field in a span of the trace of the request
+func traceResolver(name string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+
+		ctx, span := tracer.Start(p.Context, name)
+		defer span.End()
+		p.Context = ctx
+		res, err := resolve(p)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/stores/blog"
+	"github.com/zaker/anachrome-be/stores/search"
+)
+
+func execGQL(t *testing.T, bs blog.BlogStore, idx *search.Index, query string) string {
+	t.Helper()
+	if idx == nil {
+		idx = search.NewIndex(bs)
+	}
+	md, err := NewMarkdown("")
+	if err != nil {
+		t.Fatalf("NewMarkdown() error = %v", err)
+	}
+	gql, err := InitGQL(false, bs, md, idx)
+	if err != nil {
+		t.Fatalf("InitGQL() error = %v", err)
+	}
+	res := graphql.Do(graphql.Params{
+		Schema:        *gql.Conf().Schema,
+		RequestString: query,
+		Context:       context.Background(),
+	})
+	if res.HasErrors() {
+		t.Fatalf("query %s failed: %v", query, res.Errors)
+	}
+	b, err := json.Marshal(res.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestGQL_Tags(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{
+		{ID: "foo", Title: "Foo", Tags: []string{"go"}, Categories: []string{"code"}, Published: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "bar", Title: "Bar", Tags: []string{"go", "web"}, Summary: "About bar", Published: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsMetaFunc: func(ctx context.Context) ([]blog.BlogPostMeta, error) {
+			return metas, nil
+		},
+		GetBlogPostsPageFunc: func(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+			return blog.PageOf(metas, opts)
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"Tags", `{tags{tag count}}`, `{"tags":[{"count":2,"tag":"go"},{"count":1,"tag":"web"}]}`},
+		{"Blogs by tag", `{blogs(tag: "web"){id summary tags}}`, `{"blogs":[{"id":"bar","summary":"About bar","tags":["go","web"]}]}`},
+		{"Blogs by category", `{blogs(category: "code"){id categories}}`, `{"blogs":[{"categories":["code"],"id":"foo"}]}`},
+		{"Blogs newest first", `{blogs{id}}`, `{"blogs":[{"id":"bar"},{"id":"foo"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execGQL(t, mbs, nil, tt.query); got != tt.want {
+				t.Errorf("query %s = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGQL_Search(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsMetaFunc: func(ctx context.Context) ([]blog.BlogPostMeta, error) {
+			return []blog.BlogPostMeta{{ID: "foo", Title: "Foo"}, {ID: "bar", Title: "Bar"}}, nil
+		},
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id}, Content: "All about " + id}, nil
+		},
+	}
+	idx := search.NewIndex(mbs)
+	err := idx.Rebuild(context.Background())
+	if err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+
+	got := execGQL(t, mbs, idx, `{search(query: "bar"){meta{id} snippet}}`)
+	want := `{"search":[{"meta":{"id":"bar"},"snippet":"All about \u003cmark\u003ebar\u003c/mark\u003e"}]}`
+	if got != want {
+		t.Errorf("search = %s, want %s", got, want)
+	}
+}
+
+func TestGQL_BlogsConnection(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{
+		{ID: "old", Title: "Old", Published: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "mid", Title: "Mid", Published: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "new", Title: "New", Published: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsPageFunc: func(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+			return blog.PageOf(metas, opts)
+		},
+	}
+
+	first := execGQL(t, mbs, nil, `{blogsConnection(first: 2){edges{node{id}} pageInfo{hasNextPage hasPreviousPage endCursor} totalCount}}`)
+	var res struct {
+		BlogsConnection struct {
+			Edges []struct {
+				Node struct{ ID string }
+			}
+			PageInfo struct {
+				HasNextPage     bool
+				HasPreviousPage bool
+				EndCursor       string
+			}
+			TotalCount int
+		}
+	}
+	if err := json.Unmarshal([]byte(first), &res); err != nil {
+		t.Fatal(err)
+	}
+	conn := res.BlogsConnection
+	if len(conn.Edges) != 2 || conn.Edges[0].Node.ID != "new" || conn.Edges[1].Node.ID != "mid" {
+		t.Fatalf("first page = %s", first)
+	}
+	if !conn.PageInfo.HasNextPage || conn.PageInfo.HasPreviousPage || conn.TotalCount != 3 {
+		t.Errorf("first page info = %s", first)
+	}
+
+	next := execGQL(t, mbs, nil, `{blogsConnection(first: 2, after: "`+conn.PageInfo.EndCursor+`"){edges{node{id}} pageInfo{hasNextPage hasPreviousPage}}}`)
+	want := `{"blogsConnection":{"edges":[{"node":{"id":"old"}}],"pageInfo":{"hasNextPage":false,"hasPreviousPage":true}}}`
+	if next != want {
+		t.Errorf("next page = %s, want %s", next, want)
+	}
+
+	byTitle := execGQL(t, mbs, nil, `{blogsConnection(sort: TITLE, since: "2021-01-01T00:00:00Z"){edges{node{id}}}}`)
+	want = `{"blogsConnection":{"edges":[{"node":{"id":"mid"}},{"node":{"id":"new"}}]}}`
+	if byTitle != want {
+		t.Errorf("sorted by title = %s, want %s", byTitle, want)
+	}
+
+	var many []blog.BlogPostMeta
+	for i := range blog.DefaultPageSize + 1 {
+		many = append(many, blog.BlogPostMeta{ID: strconv.Itoa(i)})
+	}
+	defaulted := &mocks.MockBlogStore{
+		GetBlogPostsPageFunc: func(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+			return blog.PageOf(many, opts)
+		},
+	}
+	want = `{"blogsConnection":{"pageInfo":{"hasNextPage":true}}}`
+	if got := execGQL(t, defaulted, nil, `{blogsConnection{pageInfo{hasNextPage}}}`); got != want {
+		t.Errorf("default page = %s, want %s", got, want)
+	}
+
+	// Pages are no larger than on REST
+	gql, err := InitGQL(false, mbs, nil, search.NewIndex(mbs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, first := range []string{"0", "101"} {
+		res := graphql.Do(graphql.Params{
+			Schema:        *gql.Conf().Schema,
+			RequestString: `{blogsConnection(first: ` + first + `){totalCount}}`,
+			Context:       context.Background(),
+		})
+		if !res.HasErrors() {
+			t.Errorf("blogsConnection(first: %s) should fail", first)
+		}
+	}
+}
@@ -3,10 +3,10 @@ package services
 import (
 	"bytes"
 	"fmt"
+	"html/template"
 	"net/http"
 	"slices"
 	"strings"
-	"text/template"
 
 	"github.com/zaker/anachrome-be/stores/blog"
 )
@@ -16,6 +16,12 @@ type BlogPostMeta struct {
 	Path string `json:"path"`
 }
 
+type SearchResult struct {
+	BlogPostMeta
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
 func WantsHTML(header http.Header) bool {
 
 	for _, v := range header.Values("Accept") {
@@ -54,7 +60,7 @@ func BlogsToHTML(blogs []BlogPostMeta) (string, error) {
 	return sb.String(), nil
 }
 
-func BlogToHTML(blogs blog.BlogPost) (string, error) {
+func BlogToHTML(post blog.BlogPost) (string, error) {
 	sb := &bytes.Buffer{}
 	const tpl = `
 <!DOCTYPE html>
@@ -62,11 +68,12 @@ func BlogToHTML(blogs blog.BlogPost) (string, error) {
 	<head>
 		<meta charset="UTF-8">
 		<title>{{ .Meta.Title }}</title>
+		<link rel="stylesheet" href="/highlight.css">
 	</head>
 	<body>
 		<h1>{{ .Meta.Title }}</h1>
 		<h2>Published: {{ .Meta.Published }}</h2>
-		<p> {{ .Content }}</p>
+		<article>{{ .Content }}</article>
 	</body>
 </html>`
 
@@ -74,7 +81,14 @@ func BlogToHTML(blogs blog.BlogPost) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("parsing html template: %w", err)
 	}
-	err = t.Execute(sb, blogs)
+	err = t.Execute(sb, struct {
+		Meta    blog.BlogPostMeta
+		Content template.HTML
+	}{
+		post.Meta,
+		// ContentHTML has already been through the sanitizer
+		template.HTML(post.ContentHTML),
+	})
 	if err != nil {
 		return "", fmt.Errorf("executing html template: %w", err)
 	}
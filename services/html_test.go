@@ -98,8 +98,9 @@ func TestBlogToHTML(t *testing.T) {
 		{
 			"Should return blog html",
 			blog.BlogPost{
-				Meta:    blog.BlogPostMeta{Title: "Foo", Published: time.Date(2021, 2, 18, 10, 27, 0, 0, time.UTC)},
-				Content: "Foo text",
+				Meta:        blog.BlogPostMeta{Title: "Foo", Published: time.Date(2021, 2, 18, 10, 27, 0, 0, time.UTC)},
+				Content:     "Foo text",
+				ContentHTML: "<p>Foo text</p>",
 			},
 			`
 <!DOCTYPE html>
@@ -107,11 +108,34 @@ func TestBlogToHTML(t *testing.T) {
 	<head>
 		<meta charset="UTF-8">
 		<title>Foo</title>
+		<link rel="stylesheet" href="/highlight.css">
 	</head>
 	<body>
 		<h1>Foo</h1>
-		<h2>Published: 2021-02-18 10:27:00 +0000 UTC</h2>
-		<p> Foo text</p>
+		<h2>Published: 2021-02-18 10:27:00 &#43;0000 UTC</h2>
+		<article><p>Foo text</p></article>
+	</body>
+</html>`,
+			false,
+		},
+		{
+			"Should escape title",
+			blog.BlogPost{
+				Meta:        blog.BlogPostMeta{Title: "<b>Foo</b>", Published: time.Date(2021, 2, 18, 10, 27, 0, 0, time.UTC)},
+				ContentHTML: "<p><em>Foo</em> text</p>",
+			},
+			`
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>&lt;b&gt;Foo&lt;/b&gt;</title>
+		<link rel="stylesheet" href="/highlight.css">
+	</head>
+	<body>
+		<h1>&lt;b&gt;Foo&lt;/b&gt;</h1>
+		<h2>Published: 2021-02-18 10:27:00 &#43;0000 UTC</h2>
+		<article><p><em>Foo</em> text</p></article>
 	</body>
 </html>`,
 			false,
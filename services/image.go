@@ -0,0 +1,495 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Image formats the pipeline decodes and encodes
+const (
+	ImageJPEG = "image/jpeg"
+	ImagePNG  = "image/png"
+	ImageGIF  = "image/gif"
+)
+
+// How images are fitted in the requested width and height
+const (
+	// FitContain scales the image to fit inside the box, keeping the aspect ratio
+	FitContain = "contain"
+	// FitCover scales the image to cover the box, cropping what is outside it
+	FitCover = "cover"
+	// FitFill stretches the image to the box
+	FitFill = "fill"
+)
+
+// maxImageSize is the largest width or height that may be requested
+const maxImageSize = 4096
+
+// maxImagePixels is the most pixels a source image may have to be decoded. Small files
+// may declare huge sizes, so the size is checked before decoding.
+const maxImagePixels = 50_000_000
+
+// srcsetWidths are the widths offered to browsers for images in posts
+var srcsetWidths = []int{480, 960, 1440}
+
+// ErrInvalidImageOptions is returned for resize parameters out of range
+var ErrInvalidImageOptions = errors.New("invalid image options")
+
+// ErrImageTooLarge is returned for source images with more than maxImagePixels
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageOptions describes the image derived from a source image
+type ImageOptions struct {
+	Width  int
+	Height int
+	Fit    string
+	// Format is the content type to encode, the format of the source when empty
+	Format string
+}
+
+// ParseImageOptions reads the w, h and fit query parameters
+func ParseImageOptions(q url.Values) (ImageOptions, error) {
+
+	opts := ImageOptions{Fit: q.Get("fit")}
+	var err error
+	for _, p := range []struct {
+		name string
+		dim  *int
+	}{{"w", &opts.Width}, {"h", &opts.Height}} {
+		v := q.Get(p.name)
+		if len(v) == 0 {
+			continue
+		}
+		*p.dim, err = strconv.Atoi(v)
+		if err != nil || *p.dim < 1 || *p.dim > maxImageSize {
+			return opts, fmt.Errorf("%w: %s must be between 1 and %d", ErrInvalidImageOptions, p.name, maxImageSize)
+		}
+	}
+	switch opts.Fit {
+	case "":
+		opts.Fit = FitContain
+	case FitContain, FitCover, FitFill:
+	default:
+		return opts, fmt.Errorf("%w: fit must be contain, cover or fill", ErrInvalidImageOptions)
+	}
+	return opts, nil
+}
+
+// Resizes reports if the options change the size of the image
+func (o ImageOptions) Resizes() bool {
+	return o.Width > 0 || o.Height > 0
+}
+
+// Key identifies the derived image for a source
+func (o ImageOptions) Key() string {
+	return fmt.Sprintf("w%d:h%d:%s:%s", o.Width, o.Height, o.Fit, o.Format)
+}
+
+// ImageFormat is the content type of names with a supported image extension
+func ImageFormat(name string) (string, bool) {
+
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	switch contentType {
+	case ImageJPEG, ImagePNG, ImageGIF:
+		return contentType, true
+	}
+	return "", false
+}
+
+// NegotiateImageFormat picks the format to send for the Accept header,
+// preferring the source format when the client accepts it
+func NegotiateImageFormat(accept, source string) string {
+
+	if len(strings.TrimSpace(accept)) == 0 {
+		return source
+	}
+
+	type candidate struct {
+		format string
+		q      float64
+	}
+	var candidates []candidate
+	for _, format := range []string{source, ImageJPEG, ImagePNG, ImageGIF} {
+		if q := acceptQuality(accept, format); q > 0 {
+			candidates = append(candidates, candidate{format, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return source
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].format
+}
+
+// acceptQuality is the q value of the most specific Accept range matching the content type
+func acceptQuality(accept, contentType string) float64 {
+
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case mediaType == contentType:
+			s = 2
+		case mediaType == "image/*":
+			s = 1
+		case mediaType == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
+
+// TransformImage derives an image from the source in the source format. JPEG metadata like EXIF
+// is removed, after turning the image upright by its orientation. Animated GIFs are not resized.
+func TransformImage(src []byte, sourceFormat string, opts ImageOptions) ([]byte, error) {
+
+	if len(opts.Format) == 0 {
+		opts.Format = sourceFormat
+	}
+
+	orientation := 1
+	if sourceFormat == ImageJPEG {
+		orientation = jpegOrientation(src)
+	}
+	if sourceFormat == ImageGIF && opts.Format == ImageGIF && isAnimatedGIF(src) {
+		return src, nil
+	}
+	if !opts.Resizes() && opts.Format == sourceFormat && orientation == 1 {
+		if sourceFormat == ImageJPEG {
+			return stripJPEGMetadata(src)
+		}
+		return src, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	img = orient(img, orientation)
+	img = resize(img, opts)
+
+	out := bytes.Buffer{}
+	switch opts.Format {
+	case ImageJPEG:
+		err = jpeg.Encode(&out, flatten(img), &jpeg.Options{Quality: 85})
+	case ImagePNG:
+		err = png.Encode(&out, img)
+	case ImageGIF:
+		err = gif.Encode(&out, img, nil)
+	default:
+		err = fmt.Errorf("unsupported image format %s", opts.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// resize scales the image into the box of the options, never enlarging it
+func resize(img image.Image, opts ImageOptions) image.Image {
+
+	if !opts.Resizes() {
+		return img
+	}
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	w, h := opts.Width, opts.Height
+	if w > 0 && h > 0 && opts.Fit != FitContain && (w > srcW || h > srcH) {
+		// Shrink the box by a single factor to keep the aspect ratio it asks for
+		if w*srcH > h*srcW {
+			w, h = srcW, max(1, h*srcW/w)
+		} else {
+			w, h = max(1, w*srcH/h), srcH
+		}
+	}
+	w, h = min(w, srcW), min(h, srcH)
+
+	src := b
+	switch {
+	case w == 0:
+		w = max(1, srcW*h/srcH)
+	case h == 0:
+		h = max(1, srcH*w/srcW)
+	case opts.Fit == FitContain:
+		if srcW*h > srcH*w {
+			h = max(1, srcH*w/srcW)
+		} else {
+			w = max(1, srcW*h/srcH)
+		}
+	case opts.Fit == FitCover:
+		// Crop the source to the aspect ratio of the box around its center
+		if srcW*h > srcH*w {
+			cropW := srcH * w / h
+			src.Min.X += (srcW - cropW) / 2
+			src.Max.X = src.Min.X + cropW
+		} else {
+			cropH := srcW * h / w
+			src.Min.Y += (srcH - cropH) / 2
+			src.Max.Y = src.Min.Y + cropH
+		}
+	}
+	if w == srcW && h == srcH && src == b {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+// flatten puts transparent images on white, as JPEG has no transparency
+func flatten(img image.Image) image.Image {
+
+	if _, ok := img.(*image.YCbCr); ok {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// isAnimatedGIF looks for a second frame by walking the blocks of the GIF, without
+// decompressing frames that may each be as large as the image
+func isAnimatedGIF(src []byte) bool {
+
+	if len(src) < 13 || !bytes.HasPrefix(src, []byte("GIF")) {
+		return false
+	}
+	// colorTable is the size of the color table following a block with the flags
+	colorTable := func(flags byte) int {
+		if flags&0x80 == 0 {
+			return 0
+		}
+		return 3 << (int(flags&0x07) + 1)
+	}
+	// subBlocks is the index after the data sub-blocks starting at i
+	subBlocks := func(i int) int {
+		for i < len(src) && src[i] != 0 {
+			i += int(src[i]) + 1
+		}
+		return i + 1
+	}
+
+	frames := 0
+	i := 13 + colorTable(src[10])
+	for i < len(src) {
+		switch src[i] {
+		case 0x21:
+			// Extension introducer and label
+			i = subBlocks(i + 2)
+		case 0x2C:
+			frames++
+			if frames > 1 {
+				return true
+			}
+			if i+10 > len(src) {
+				return false
+			}
+			// Image descriptor, local color table and LZW minimum code size
+			i = subBlocks(i + 10 + colorTable(src[i+9]) + 1)
+		default:
+			// Trailer
+			return false
+		}
+	}
+	return false
+}
+
+// orient turns the image upright by its EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegSegments calls f with the marker and payload of every segment before the image data
+func jpegSegments(src []byte, f func(marker byte, payload []byte)) (scan int, err error) {
+
+	if len(src) < 2 || src[0] != 0xFF || src[1] != 0xD8 {
+		return 0, fmt.Errorf("not a jpeg")
+	}
+	i := 2
+	for i+4 <= len(src) {
+		if src[i] != 0xFF {
+			return 0, fmt.Errorf("invalid jpeg marker at %d", i)
+		}
+		marker := src[i+1]
+		if marker == 0xDA {
+			// Start of scan, the image data follows
+			return i, nil
+		}
+		length := int(binary.BigEndian.Uint16(src[i+2:]))
+		if length < 2 || i+2+length > len(src) {
+			return 0, fmt.Errorf("invalid jpeg segment length at %d", i)
+		}
+		f(marker, src[i+4:i+2+length])
+		i += 2 + length
+	}
+	return 0, fmt.Errorf("jpeg without image data")
+}
+
+// stripJPEGMetadata removes the EXIF, XMP and IPTC segments of a JPEG without re-encoding it
+func stripJPEGMetadata(src []byte) ([]byte, error) {
+
+	out := bytes.NewBuffer(make([]byte, 0, len(src)))
+	out.Write(src[:2])
+	scan, err := jpegSegments(src, func(marker byte, payload []byte) {
+		if marker == 0xE1 || marker == 0xED {
+			return
+		}
+		out.Write([]byte{0xFF, marker})
+		_ = binary.Write(out, binary.BigEndian, uint16(len(payload)+2))
+		out.Write(payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Write(src[scan:])
+	return out.Bytes(), nil
+}
+
+// jpegOrientation reads the orientation tag from the EXIF segment, 1 is upright
+func jpegOrientation(src []byte) int {
+
+	orientation := 1
+	_, _ = jpegSegments(src, func(marker byte, payload []byte) {
+		if marker != 0xE1 || !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return
+		}
+		tiff := payload[6:]
+		if len(tiff) < 8 {
+			return
+		}
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for e := 0; e < entries; e++ {
+			entry := ifd + 2 + e*12
+			if entry+12 > len(tiff) {
+				return
+			}
+			if order.Uint16(tiff[entry:]) == 0x0112 {
+				orientation = int(order.Uint16(tiff[entry+8:]))
+				return
+			}
+		}
+	})
+	return orientation
+}
+
+// Srcset lists the resized variants of an image for the srcset attribute, those
+// narrower than the source. It is empty when no variant is.
+func Srcset(imageURL string, sourceWidth int) string {
+
+	variants := make([]string, 0, len(srcsetWidths))
+	for _, w := range srcsetWidths {
+		if w >= sourceWidth {
+			break
+		}
+		variants = append(variants, imageURL+"?w="+strconv.Itoa(w)+" "+strconv.Itoa(w)+"w")
+	}
+	return strings.Join(variants, ", ")
+}
+
+// imageHeaderBytes is how much of an image file is read to learn its size
+const imageHeaderBytes = 256 << 10
+
+// ImageWidth reads the width of the image, turned upright, from the start of the file
+func ImageWidth(r io.Reader, sourceFormat string) (int, error) {
+
+	head, err := io.ReadAll(io.LimitReader(r, imageHeaderBytes))
+	if err != nil {
+		return 0, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return 0, fmt.Errorf("decoding image: %w", err)
+	}
+	// Orientations from 5 turn the image on its side
+	if sourceFormat == ImageJPEG && jpegOrientation(head) >= 5 {
+		return cfg.Height, nil
+	}
+	return cfg.Width, nil
+}
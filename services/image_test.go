@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage is a w by h image that is red in the top left corner and blue elsewhere
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < w/4 && y < h/4 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	b := bytes.Buffer{}
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// withExif inserts an EXIF segment with the orientation after the start of a JPEG
+func withExif(src []byte, orientation uint16) []byte {
+
+	tiff := bytes.Buffer{}
+	tiff.WriteString("MM")
+	for _, v := range []any{uint16(42), uint32(8), uint16(1),
+		uint16(0x0112), uint16(3), uint32(1), orientation, uint16(0), uint32(0)} {
+		_ = binary.Write(&tiff, binary.BigEndian, v)
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	out := bytes.Buffer{}
+	out.Write(src[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(src[2:])
+	return out.Bytes()
+}
+
+func decodeConfig(t *testing.T, b []byte) (image.Config, string) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	return cfg, format
+}
+
+func TestParseImageOptions(t *testing.T) {
+
+	tests := []struct {
+		query   string
+		want    ImageOptions
+		wantErr bool
+	}{
+		{"", ImageOptions{Fit: FitContain}, false},
+		{"w=300", ImageOptions{Width: 300, Fit: FitContain}, false},
+		{"w=300&h=200&fit=cover", ImageOptions{Width: 300, Height: 200, Fit: FitCover}, false},
+		{"h=20&fit=fill", ImageOptions{Height: 20, Fit: FitFill}, false},
+		{"w=0", ImageOptions{}, true},
+		{"w=5000", ImageOptions{}, true},
+		{"h=big", ImageOptions{}, true},
+		{"fit=stretch", ImageOptions{}, true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		got, err := ParseImageOptions(q)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrInvalidImageOptions, tt.query)
+			continue
+		}
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestNegotiateImageFormat(t *testing.T) {
+
+	tests := []struct {
+		accept string
+		source string
+		want   string
+	}{
+		{"", ImagePNG, ImagePNG},
+		{"*/*", ImagePNG, ImagePNG},
+		{"image/webp,image/*,*/*;q=0.8", ImageGIF, ImageGIF},
+		{"image/jpeg", ImagePNG, ImageJPEG},
+		{"image/png;q=0.5, image/jpeg", ImagePNG, ImageJPEG},
+		{"image/*, image/png;q=0", ImagePNG, ImageJPEG},
+		{"text/html", ImagePNG, ImagePNG},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, NegotiateImageFormat(tt.accept, tt.source), tt.accept)
+	}
+}
+
+func TestTransformImage(t *testing.T) {
+
+	src := encodePNG(t, testImage(400, 200))
+
+	tests := []struct {
+		name       string
+		opts       ImageOptions
+		wantW      int
+		wantH      int
+		wantFormat string
+	}{
+		{"Width", ImageOptions{Width: 100, Fit: FitContain}, 100, 50, "png"},
+		{"Height", ImageOptions{Height: 100, Fit: FitContain}, 200, 100, "png"},
+		{"Contain", ImageOptions{Width: 100, Height: 100, Fit: FitContain}, 100, 50, "png"},
+		{"Cover", ImageOptions{Width: 100, Height: 100, Fit: FitCover}, 100, 100, "png"},
+		{"Fill", ImageOptions{Width: 100, Height: 100, Fit: FitFill}, 100, 100, "png"},
+		{"Cover larger than source", ImageOptions{Width: 800, Height: 100, Fit: FitCover}, 400, 50, "png"},
+		{"Fill larger than source", ImageOptions{Width: 300, Height: 600, Fit: FitFill}, 100, 200, "png"},
+		{"No upscaling", ImageOptions{Width: 800, Fit: FitContain}, 400, 200, "png"},
+		{"To jpeg", ImageOptions{Width: 40, Fit: FitContain, Format: ImageJPEG}, 40, 20, "jpeg"},
+		{"To gif", ImageOptions{Fit: FitContain, Format: ImageGIF}, 400, 200, "gif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransformImage(src, ImagePNG, tt.opts)
+			if err != nil {
+				t.Fatalf("TransformImage() error = %v", err)
+			}
+			cfg, format := decodeConfig(t, got)
+			assert.Equal(t, tt.wantW, cfg.Width)
+			assert.Equal(t, tt.wantH, cfg.Height)
+			assert.Equal(t, tt.wantFormat, format)
+		})
+	}
+
+	// Unchanged images are served as they are
+	got, err := TransformImage(src, ImagePNG, ImageOptions{Fit: FitContain})
+	assert.NoError(t, err)
+	assert.Equal(t, src, got)
+
+	_, err = TransformImage([]byte("not an image"), ImagePNG, ImageOptions{Width: 10})
+	assert.Error(t, err)
+}
+
+func TestTransformImage_AnimatedGIF(t *testing.T) {
+
+	p := color.Palette{color.Black, color.White}
+	frame := func() *image.Paletted { return image.NewPaletted(image.Rect(0, 0, 20, 20), p) }
+	b := bytes.Buffer{}
+	err := gif.EncodeAll(&b, &gif.GIF{Image: []*image.Paletted{frame(), frame()}, Delay: []int{10, 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := TransformImage(b.Bytes(), ImageGIF, ImageOptions{Width: 10, Fit: FitContain})
+	assert.NoError(t, err)
+	assert.Equal(t, b.Bytes(), got)
+
+	// Frames with their own color tables
+	local := image.NewPaletted(image.Rect(0, 0, 20, 20), color.Palette{color.White, color.Black, color.Transparent})
+	b.Reset()
+	err = gif.EncodeAll(&b, &gif.GIF{Image: []*image.Paletted{frame(), local}, Delay: []int{10, 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, isAnimatedGIF(b.Bytes()))
+	b.Reset()
+	err = gif.EncodeAll(&b, &gif.GIF{Image: []*image.Paletted{local}, Delay: []int{10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, isAnimatedGIF(b.Bytes()))
+}
+
+func TestTransformImage_TooLarge(t *testing.T) {
+
+	b := bytes.Buffer{}
+	err := gif.Encode(&b, image.NewPaletted(image.Rect(0, 0, 20, 20), color.Palette{color.Black}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A small file declaring a huge logical screen
+	src := b.Bytes()
+	binary.LittleEndian.PutUint16(src[6:], 65535)
+	binary.LittleEndian.PutUint16(src[8:], 65535)
+
+	_, err = TransformImage(src, ImageGIF, ImageOptions{Width: 10, Fit: FitContain})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func TestTransformImage_Exif(t *testing.T) {
+
+	b := bytes.Buffer{}
+	if err := jpeg.Encode(&b, testImage(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := b.Bytes()
+
+	// Upright images keep their image data, without the EXIF segment
+	src := withExif(plain, 1)
+	assert.Equal(t, 1, jpegOrientation(src))
+	got, err := TransformImage(src, ImageJPEG, ImageOptions{Fit: FitContain})
+	assert.NoError(t, err)
+	assert.Equal(t, plain, got)
+
+	// Rotated images are turned upright, 6 is rotated 90 degrees clockwise
+	src = withExif(plain, 6)
+	assert.Equal(t, 6, jpegOrientation(src))
+	got, err = TransformImage(src, ImageJPEG, ImageOptions{Fit: FitContain})
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(got, []byte("Exif")))
+	cfg, _ := decodeConfig(t, got)
+	assert.Equal(t, 20, cfg.Width)
+	assert.Equal(t, 40, cfg.Height)
+
+	img, err := jpeg.Decode(bytes.NewReader(got))
+	assert.NoError(t, err)
+	r, _, bl, _ := img.At(17, 2).RGBA()
+	assert.Greater(t, r, bl, "the red corner is at the top right")
+}
+
+func TestSrcset(t *testing.T) {
+	assert.Equal(t,
+		"/a/cat.png?w=480 480w, /a/cat.png?w=960 960w, /a/cat.png?w=1440 1440w",
+		Srcset("/a/cat.png", 2000))
+	// Variants are never wider than the source
+	assert.Equal(t, "/a/cat.png?w=480 480w, /a/cat.png?w=960 960w", Srcset("/a/cat.png", 1440))
+	assert.Empty(t, Srcset("/a/cat.png", 480))
+	assert.Empty(t, Srcset("/a/cat.png", 0))
+	assert.Regexp(t, srcsetPattern, Srcset("https://example.com/blog/foo/assets/img/my%20cat.png", 2000))
+}
+
+func TestImageWidth(t *testing.T) {
+
+	w, err := ImageWidth(bytes.NewReader(encodePNG(t, testImage(40, 20))), ImagePNG)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, w)
+
+	b := bytes.Buffer{}
+	if err := jpeg.Encode(&b, testImage(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Images on their side are as wide as they are high when turned upright
+	w, err = ImageWidth(bytes.NewReader(withExif(b.Bytes(), 6)), ImageJPEG)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, w)
+
+	_, err = ImageWidth(bytes.NewReader([]byte("PNG")), ImagePNG)
+	assert.Error(t, err)
+}
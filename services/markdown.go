@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/go-redis/cache/v8"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"github.com/zaker/anachrome-be/stores/blog"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultHighlightStyle is the chroma style used when none is configured
+const DefaultHighlightStyle = "github"
+
+// Markdown renders blog post content to sanitized HTML
+type Markdown struct {
+	md         goldmark.Markdown
+	policy     *bluemonday.Policy
+	cache      *cache.TinyLFU
+	styleSheet []byte
+	assets     blog.AssetStore
+	widths     *cache.TinyLFU
+}
+
+// NewMarkdown creates a CommonMark renderer with GFM tables, footnotes and fenced code.
+// Fenced code with a language tag is highlighted with classes from the named chroma style.
+func NewMarkdown(highlightStyle string) (*Markdown, error) {
+
+	if highlightStyle == "" {
+		highlightStyle = DefaultHighlightStyle
+	}
+	style, ok := styles.Registry[highlightStyle]
+	if !ok {
+		return nil, fmt.Errorf("unknown highlight style %q", highlightStyle)
+	}
+	css := bytes.Buffer{}
+	err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&css, style)
+	if err != nil {
+		return nil, fmt.Errorf("generating highlight stylesheet: %w", err)
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			extension.Linkify,
+			extension.Strikethrough,
+			extension.TaskList,
+			extension.NewTable(
+				extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Footnote,
+			highlighting.NewHighlighting(
+				highlighting.WithCustomStyle(style),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+			),
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithASTTransformers(util.Prioritized(assetLinkTransformer{}, 100)),
+		),
+	)
+
+	policy := bluemonday.UGCPolicy()
+	policy.RequireNoFollowOnLinks(false)
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	policy.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).OnElements("a", "div", "pre", "span")
+	policy.AllowAttrs("role").Matching(bluemonday.SpaceSeparatedTokens).OnElements("a", "div")
+	policy.AllowAttrs("type", "checked", "disabled").OnElements("input")
+	policy.AllowAttrs("srcset").Matching(srcsetPattern).OnElements("img")
+
+	return &Markdown{
+		md:         md,
+		policy:     policy,
+		cache:      cache.NewTinyLFU(1000, time.Hour),
+		styleSheet: css.Bytes(),
+		widths:     cache.NewTinyLFU(1000, time.Hour),
+	}, nil
+}
+
+// SizeImages looks up the images of posts in the asset store, so that their srcset
+// only offers variants narrower than the image. Without it images get no srcset.
+func (m *Markdown) SizeImages(assets blog.AssetStore) {
+	m.assets = assets
+}
+
+// imageWidth is the width of the named asset, zero when it is unknown
+func (m *Markdown) imageWidth(ctx context.Context, name string) int {
+
+	if m.assets == nil {
+		return 0
+	}
+	if b, ok := m.widths.Get(name); ok {
+		w, _ := strconv.Atoi(string(b))
+		return w
+	}
+	format, _ := ImageFormat(name)
+	asset, err := m.assets.GetAsset(ctx, name)
+	if err != nil {
+		slog.DebugContext(ctx, "getting image for srcset", slog.String("name", name), slog.Any("err", err))
+		return 0
+	}
+	defer asset.Content.Close()
+	w, err := ImageWidth(asset.Content, format)
+	if err != nil {
+		slog.DebugContext(ctx, "reading image width", slog.String("name", name), slog.Any("err", err))
+		return 0
+	}
+	m.widths.Set(name, []byte(strconv.Itoa(w)))
+	return w
+}
+
+// StyleSheet returns the CSS for the classes of highlighted code blocks
+func (m *Markdown) StyleSheet() []byte {
+	return m.styleSheet
+}
+
+// Render converts markdown to sanitized HTML, caching the result per content hash
+func (m *Markdown) Render(content string) (string, error) {
+	return m.RenderPost(context.Background(), content, "")
+}
+
+// RenderPost converts the markdown of a post to sanitized HTML like Render,
+// with relative links to images and attachments pointing into assetPath
+func (m *Markdown) RenderPost(ctx context.Context, content, assetPath string) (string, error) {
+
+	ctx, span := tracer.Start(ctx, "Markdown.RenderPost")
+	defer span.End()
+
+	sum := sha256.Sum256([]byte(assetPath + "\x00" + content))
+	key := hex.EncodeToString(sum[:])
+	if b, ok := m.cache.Get(key); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return string(b), nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	pc := parser.NewContext()
+	pc.Set(assetPathKey, assetPath)
+	pc.Set(imageWidthKey, func(name string) int { return m.imageWidth(ctx, name) })
+	b := bytes.Buffer{}
+	err := m.md.Convert([]byte(content), &b, parser.WithContext(pc))
+	if err != nil {
+		return "", fmt.Errorf("rendering markdown: %w", err)
+	}
+
+	out := m.policy.SanitizeBytes(b.Bytes())
+	m.cache.Set(key, out)
+	return string(out), nil
+}
+
+// AssetPath is the absolute link to the assets of a post
+func AssetPath(basePath, id string) string {
+	return BlogPostPath(basePath, id) + "/assets/"
+}
+
+var (
+	assetPathKey  = parser.NewContextKey()
+	imageWidthKey = parser.NewContextKey()
+)
+
+// srcsetPattern matches the srcset attributes the asset link transformer adds
+var srcsetPattern = regexp.MustCompile(`^(?:https?://|/)[^\s,]+ \d+w(?:, (?:https?://|/)[^\s,]+ \d+w)*$`)
+
+// assetLinkTransformer points relative image and attachment links into the asset path in the parser context
+type assetLinkTransformer struct{}
+
+func (assetLinkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+
+	assetPath, _ := pc.Get(assetPathKey).(string)
+	if len(assetPath) == 0 {
+		return
+	}
+	imageWidth, _ := pc.Get(imageWidthKey).(func(string) int)
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Image:
+			if name, ok := relativeAsset(string(n.Destination)); ok {
+				n.Destination = []byte(assetPath + name)
+				// Offer smaller variants of images the server can resize
+				if _, ok := ImageFormat(name); ok && !strings.Contains(name, "?") && imageWidth != nil {
+					source, err := url.PathUnescape(name)
+					if err != nil {
+						break
+					}
+					if srcset := Srcset(assetPath+name, imageWidth(source)); len(srcset) > 0 {
+						n.SetAttributeString("srcset", []byte(srcset))
+					}
+				}
+			}
+		case *ast.Link:
+			// Links without an extension or to other posts are pages, not attachments
+			if name, ok := relativeAsset(string(n.Destination)); ok && path.Ext(name) != "" {
+				n.Destination = []byte(assetPath + name)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// relativeAsset returns the escaped asset name of a link relative to the post
+func relativeAsset(dest string) (string, bool) {
+
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	name := path.Clean(u.Path)
+	if !blog.ValidAssetName(name) {
+		return "", false
+	}
+	u.Path = name
+	return u.String(), true
+}
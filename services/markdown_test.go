@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+func TestMarkdown_Render(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Empty content", "", ""},
+		{"Paragraph", "Foo *text*", "<p>Foo <em>text</em></p>\n"},
+		{"Escapes text", "1 < 2 & 3 > 2", "<p>1 &lt; 2 &amp; 3 &gt; 2</p>\n"},
+		{"Drops raw html", "Foo <script>alert(1)</script>", "<p>Foo alert(1)</p>\n"},
+		{"Drops unsafe links", "[Foo](javascript:alert(1))", "<p>Foo</p>\n"},
+		{
+			"Table",
+			"| a | b |\n|:--|--:|\n| 1 | 2 |",
+			"<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"right\">b</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td align=\"left\">1</td>\n<td align=\"right\">2</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			"Fenced code",
+			"```\nfmt.Println(\"<hi>\")\n```",
+			"<pre><code>fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n",
+		},
+		{
+			"Highlighted fenced code",
+			"```go\nfmt.Println(\"<hi>\")\n```",
+			"<pre class=\"chroma\"><code><span class=\"line\"><span class=\"cl\">" +
+				"<span class=\"nx\">fmt</span><span class=\"p\">.</span><span class=\"nf\">Println</span>" +
+				"<span class=\"p\">(</span><span class=\"s\">&#34;&lt;hi&gt;&#34;</span><span class=\"p\">)</span>" +
+				"<span class=\"w\">\n</span></span></span></code></pre>",
+		},
+		{
+			"Footnote",
+			"Foo[^1]\n\n[^1]: Bar",
+			"<p>Foo<sup id=\"fnref:1\"><a href=\"#fn:1\" class=\"footnote-ref\" role=\"doc-noteref\">1</a></sup></p>\n" +
+				"<div class=\"footnotes\" role=\"doc-endnotes\">\n<hr>\n<ol>\n<li id=\"fn:1\">\n" +
+				"<p>Bar\u00a0<a href=\"#fnref:1\" class=\"footnote-backref\" role=\"doc-backlink\">↩︎</a></p>\n</li>\n</ol>\n</div>\n",
+		},
+	}
+	md, err := NewMarkdown("")
+	if err != nil {
+		t.Fatalf("NewMarkdown() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Render twice so the cached result is checked as well
+			for range 2 {
+				got, err := md.Render(tt.content)
+				if err != nil {
+					t.Errorf("Markdown.Render() error = %v", err)
+					return
+				}
+				if got != tt.want {
+					t.Errorf("Markdown.Render() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMarkdown(t *testing.T) {
+
+	md, err := NewMarkdown("monokai")
+	if err != nil {
+		t.Fatalf("NewMarkdown() error = %v", err)
+	}
+	if !bytes.Contains(md.StyleSheet(), []byte(".chroma .nf")) {
+		t.Errorf("StyleSheet() is missing classes for highlighted code")
+	}
+
+	_, err = NewMarkdown("no-such-style")
+	if err == nil {
+		t.Errorf("NewMarkdown() should fail for unknown styles")
+	}
+}
+
+func TestRenderedBlogStore(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id}, Content: "Foo *text* ![cat](cat.png)"}, nil
+		},
+	}
+	md, err := NewMarkdown("")
+	if err != nil {
+		t.Fatalf("NewMarkdown() error = %v", err)
+	}
+	md.SizeImages(testAssetStore{"cat.png": encodePNG(t, testImage(1000, 10))})
+
+	post, err := NewRenderedBlogStore(mbs, md, "https://example.com").GetBlogPost(context.Background(), "foo")
+	if err != nil {
+		t.Fatalf("GetBlogPost() error = %v", err)
+	}
+	assert.Equal(t, `<p>Foo <em>text</em> <img src="https://example.com/blog/foo/assets/cat.png" alt="cat" srcset="https://example.com/blog/foo/assets/cat.png?w=480 480w, https://example.com/blog/foo/assets/cat.png?w=960 960w"></p>`+"\n", post.ContentHTML)
+}
+
+func TestMarkdown_RenderPost(t *testing.T) {
+
+	md, err := NewMarkdown("")
+	if err != nil {
+		t.Fatalf("NewMarkdown() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Relative image", "![cat](cat.png)", `<img src="/blog/foo/assets/cat.png" alt="cat">`},
+		{"Image in a subfolder", "![cat](./img/my%20cat.png?w=300)", `<img src="/blog/foo/assets/img/my%20cat.png?w=300" alt="cat">`},
+		{"Attachment", "[paper](paper.pdf)", `<a href="/blog/foo/assets/paper.pdf">paper</a>`},
+		{"Absolute image", "![cat](https://example.com/cat.png)", `<img src="https://example.com/cat.png" alt="cat">`},
+		{"Root relative image", "![cat](/cat.png)", `<img src="/cat.png" alt="cat">`},
+		{"Outside the folder", "![cat](../cat.png)", `<img src="../cat.png" alt="cat">`},
+		{"Other post", "[bar](bar.md)", `<a href="bar.md">bar</a>`},
+		{"Page", "[about](about)", `<a href="about">about</a>`},
+		{"Anchor", "[top](#top)", `<a href="#top">top</a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := md.RenderPost(t.Context(), tt.content, AssetPath("", "foo"))
+			if err != nil {
+				t.Fatalf("RenderPost() error = %v", err)
+			}
+			assert.Equal(t, "<p>"+tt.want+"</p>\n", got)
+		})
+	}
+
+	// Rendered without an asset path the links are left alone
+	got, err := md.Render("![cat](cat.png)")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	assert.Equal(t, `<p><img src="cat.png" alt="cat"></p>`+"\n", got)
+}
+
+// testAssetStore serves the named files as assets
+type testAssetStore map[string][]byte
+
+func (ts testAssetStore) GetAsset(ctx context.Context, name string) (blog.Asset, error) {
+	b, ok := ts[name]
+	if !ok {
+		return blog.Asset{}, blog.ErrAssetNotFound
+	}
+	return blog.Asset{Name: name, Size: int64(len(b)), Content: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func TestMarkdown_SizeImages(t *testing.T) {
+
+	md, err := NewMarkdown("")
+	if err != nil {
+		t.Fatalf("NewMarkdown() error = %v", err)
+	}
+	md.SizeImages(testAssetStore{
+		"wide.png":       encodePNG(t, testImage(2000, 10)),
+		"img/my cat.png": encodePNG(t, testImage(600, 10)),
+		"small.png":      encodePNG(t, testImage(100, 10)),
+		"broken.png":     []byte("PNG"),
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Wide image", "![a](wide.png)", `<img src="/blog/foo/assets/wide.png" alt="a" srcset="/blog/foo/assets/wide.png?w=480 480w, /blog/foo/assets/wide.png?w=960 960w, /blog/foo/assets/wide.png?w=1440 1440w">`},
+		{"Escaped name", "![a](img/my%20cat.png)", `<img src="/blog/foo/assets/img/my%20cat.png" alt="a" srcset="/blog/foo/assets/img/my%20cat.png?w=480 480w">`},
+		{"Small image", "![a](small.png)", `<img src="/blog/foo/assets/small.png" alt="a">`},
+		{"Unknown width", "![a](broken.png)", `<img src="/blog/foo/assets/broken.png" alt="a">`},
+		{"Missing image", "![a](missing.png)", `<img src="/blog/foo/assets/missing.png" alt="a">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := md.RenderPost(t.Context(), tt.content, AssetPath("", "foo"))
+			if err != nil {
+				t.Fatalf("RenderPost() error = %v", err)
+			}
+			assert.Equal(t, "<p>"+tt.want+"</p>\n", got)
+		})
+	}
+}
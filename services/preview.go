@@ -0,0 +1,65 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrPreviewExpired is returned for preview links past their expiry
+	ErrPreviewExpired = errors.New("preview link expired")
+	// ErrPreviewSignature is returned for preview links not signed with the secret
+	ErrPreviewSignature = errors.New("invalid preview signature")
+)
+
+// PreviewSigner signs links that show drafts and scheduled posts until they expire
+type PreviewSigner struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func NewPreviewSigner(secret string) *PreviewSigner {
+	return &PreviewSigner{secret: []byte(secret), now: time.Now}
+}
+
+func (ps *PreviewSigner) signature(id string, expires int64) []byte {
+	mac := hmac.New(sha256.New, ps.secret)
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return mac.Sum(nil)
+}
+
+// URL is the preview link of the post, valid until expires
+func (ps *PreviewSigner) URL(basePath, id string, expires time.Time) string {
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", hex.EncodeToString(ps.signature(id, expires.Unix())))
+	return PreviewPath(basePath, id) + "?" + q.Encode()
+}
+
+// Verify checks the expires and signature query parameters of a preview link
+func (ps *PreviewSigner) Verify(id string, q url.Values) error {
+
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrPreviewSignature
+	}
+	signature, err := hex.DecodeString(q.Get("signature"))
+	if err != nil || !hmac.Equal(signature, ps.signature(id, expires)) {
+		return ErrPreviewSignature
+	}
+	if ps.now().Unix() > expires {
+		return ErrPreviewExpired
+	}
+	return nil
+}
+
+// PreviewPath is the absolute link to the preview of a post
+func PreviewPath(basePath, id string) string {
+	return BlogPostPath(basePath, id) + "/preview"
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewSigner(t *testing.T) {
+
+	ps := NewPreviewSigner("secret")
+	ps.now = func() time.Time { return time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC) }
+	expires := time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)
+
+	link := ps.URL("https://example.com", "foo", expires)
+	assert.True(t, strings.HasPrefix(link, "https://example.com/blog/foo/preview?expires=1616112000&signature="), link)
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	assert.NoError(t, ps.Verify("foo", q))
+	assert.ErrorIs(t, ps.Verify("bar", q), ErrPreviewSignature)
+
+	// Extending the expiry breaks the signature
+	extended := url.Values{"expires": {"1716112000"}, "signature": q["signature"]}
+	assert.ErrorIs(t, ps.Verify("foo", extended), ErrPreviewSignature)
+
+	ps.now = func() time.Time { return expires.Add(time.Second) }
+	assert.ErrorIs(t, ps.Verify("foo", q), ErrPreviewExpired)
+
+	assert.ErrorIs(t, ps.Verify("foo", url.Values{}), ErrPreviewSignature)
+}
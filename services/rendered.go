@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+// RenderedBlogStore fills in the rendered HTML of posts from the wrapped store,
+// so caches in front of it keep the highlighted HTML together with the post
+type RenderedBlogStore struct {
+	blog.BlogStore
+	markdown *Markdown
+	basePath string
+}
+
+func NewRenderedBlogStore(blogStore blog.BlogStore, markdown *Markdown, basePath string) *RenderedBlogStore {
+	return &RenderedBlogStore{blogStore, markdown, basePath}
+}
+
+func (rbs *RenderedBlogStore) GetBlogPost(ctx context.Context, id string) (blog.BlogPost, error) {
+
+	post, err := rbs.BlogStore.GetBlogPost(ctx, id)
+	if err != nil {
+		return post, err
+	}
+	post.ContentHTML, err = rbs.markdown.RenderPost(ctx, post.Content, AssetPath(rbs.basePath, id))
+	if err != nil {
+		return blog.BlogPost{}, err
+	}
+	return post, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Sitemap lists the blog and its posts in the sitemaps.org format
+func Sitemap(basePath string, metas []blog.BlogPostMeta) ([]byte, time.Time, error) {
+
+	var modified time.Time
+	urls := make([]sitemapURL, 0, len(metas)+1)
+	for _, meta := range metas {
+		if meta.Updated.After(modified) {
+			modified = meta.Updated
+		}
+		urls = append(urls, sitemapURL{
+			Loc:     BlogPostPath(basePath, meta.ID),
+			LastMod: lastMod(meta.Updated),
+		})
+	}
+	urls = append([]sitemapURL{{Loc: basePath + "/blog", LastMod: lastMod(modified)}}, urls...)
+
+	b, err := marshalXML(sitemapURLSet{URLs: urls})
+	if err != nil {
+		return nil, modified, err
+	}
+	return b, modified, nil
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Robots appends the sitemap location to the robots.txt rules
+func Robots(basePath, rules string) string {
+	if len(rules) == 0 {
+		rules = "User-agent: *\nAllow: /\n"
+	}
+	if rules[len(rules)-1] != '\n' {
+		rules += "\n"
+	}
+	return rules + "\nSitemap: " + basePath + "/sitemap.xml\n"
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+func TestSitemap(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{
+		{ID: "foo", Updated: time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC)},
+		{ID: "bar", Updated: time.Date(2021, 3, 19, 10, 27, 0, 0, time.UTC)},
+		{ID: "baz"},
+	}
+	got, modified, err := Sitemap("https://example.com", metas)
+	if err != nil {
+		t.Fatalf("Sitemap() error = %v", err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>https://example.com/blog</loc><lastmod>2021-03-19T10:27:00Z</lastmod></url>` +
+		`<url><loc>https://example.com/blog/foo</loc><lastmod>2021-03-18T10:27:00Z</lastmod></url>` +
+		`<url><loc>https://example.com/blog/bar</loc><lastmod>2021-03-19T10:27:00Z</lastmod></url>` +
+		`<url><loc>https://example.com/blog/baz</loc></url>` +
+		`</urlset>`
+	if string(got) != want {
+		t.Errorf("Sitemap() = %s, want %s", got, want)
+	}
+	if !modified.Equal(metas[1].Updated) {
+		t.Errorf("Sitemap() modified = %v, want %v", modified, metas[1].Updated)
+	}
+}
+
+func TestRobots(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"Default rules", "", "User-agent: *\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n"},
+		{"Configured rules", "User-agent: *\nDisallow: /gql", "User-agent: *\nDisallow: /gql\n\nSitemap: https://example.com/sitemap.xml\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Robots("https://example.com", tt.rules); got != tt.want {
+				t.Errorf("Robots() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collectorStub receives spans like an OTLP/HTTP collector
+type collectorStub struct {
+	mu       sync.Mutex
+	services []string
+	spans    []*tracepb.Span
+}
+
+func (cs *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req collectorpb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, attr := range rs.Resource.Attributes {
+			if attr.Key == "service.name" {
+				cs.services = append(cs.services, attr.Value.GetStringValue())
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			cs.spans = append(cs.spans, ss.Spans...)
+		}
+	}
+	resp, _ := proto.Marshal(&collectorpb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+func TestInitTracing(t *testing.T) {
+
+	collector := &collectorStub{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	shutdown, err := InitTracing(t.Context(), srv.URL, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := NewMarkdown("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := otel.Tracer("test").Start(t.Context(), "request")
+	_, err = md.RenderPost(ctx, "# Foo", "")
+	assert.NoError(t, err)
+	span.End()
+	assert.NoError(t, shutdown(t.Context()), "spans are flushed on shutdown")
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	assert.Contains(t, collector.services, serviceName)
+	spans := map[string]*tracepb.Span{}
+	for _, s := range collector.spans {
+		spans[s.Name] = s
+	}
+	if assert.Contains(t, spans, "request") && assert.Contains(t, spans, "Markdown.RenderPost") {
+		assert.Equal(t, spans["request"].TraceId, spans["Markdown.RenderPost"].TraceId)
+		assert.Equal(t, spans["request"].SpanId, spans["Markdown.RenderPost"].ParentSpanId)
+	}
+}
@@ -0,0 +1,44 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrAssetNotFound is returned when no file has the asset name
+var ErrAssetNotFound = errors.New("asset not found")
+
+// Asset is a file next to the posts, like an image, that posts link to
+type Asset struct {
+	Name        string
+	ContentHash string
+	Size        int64
+	Modified    time.Time
+	Content     io.ReadCloser
+}
+
+// AssetStore serves the files posts link to. Names are slash separated paths
+// relative to the folder holding the posts.
+type AssetStore interface {
+	GetAsset(ctx context.Context, name string) (Asset, error)
+}
+
+// ValidAssetName reports if name is a relative path that stays inside the folder
+// holding the posts, and is not a post itself
+func ValidAssetName(name string) bool {
+
+	if name == "" || strings.HasPrefix(name, "/") || path.Clean(name) != name {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	// Dropbox paths are case insensitive, DRAFT.MD is the draft.md post
+	return !strings.EqualFold(path.Ext(name), ".md")
+}
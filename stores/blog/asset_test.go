@@ -0,0 +1,30 @@
+package blog
+
+import "testing"
+
+func TestValidAssetName(t *testing.T) {
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"cat.png", true},
+		{"img/cat.png", true},
+		{"paper.pdf", true},
+		{"", false},
+		{"post.md", false},
+		{"post.MD", false},
+		{"img/post.Md", false},
+		{"/etc/passwd", false},
+		{"../secret.png", false},
+		{"img/../../secret.png", false},
+		{"./cat.png", false},
+		{".git/config", false},
+		{"img//cat.png", false},
+	}
+	for _, tt := range tests {
+		if got := ValidAssetName(tt.name); got != tt.want {
+			t.Errorf("ValidAssetName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package blog
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -12,73 +14,139 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-//go:generate moq -pkg mocks -out ../../mocks/blog.go . BlogStore
+//go:generate moq -pkg mocks -out ../../mocks/blog.go . BlogStore:MockBlogStore
 type BlogStore interface {
 	GetBlogPostsMeta(context.Context) ([]BlogPostMeta, error)
+	GetBlogPostsPage(context.Context, ListOptions) (BlogPostsPage, error)
 	GetBlogPost(context.Context, string) (BlogPost, error)
 }
 
 type DropboxBlog struct {
-	client      *dropbox.Client
-	UpdatesChan chan string
+	client       *dropbox.Client
+	syncRequests chan dropbox.SyncRequest
+	done         chan struct{}
+	UpdatesChan  chan string
 }
 
 type BlogPostMeta struct {
-	Title     string    `json:"title,omitempty"`
-	ID        string    `json:"id,omitempty"`
-	Published time.Time `json:"published,omitempty"`
-	Updated   time.Time `json:"updated,omitempty"`
+	Title      string    `json:"title,omitempty"`
+	ID         string    `json:"id,omitempty"`
+	Published  time.Time `json:"published,omitempty"`
+	Updated    time.Time `json:"updated,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Categories []string  `json:"categories,omitempty"`
+	Summary    string    `json:"summary,omitempty"`
+	Draft      bool      `json:"draft,omitempty"`
+	// ContentHash identifies the content of the post file, it is kept by the caches to validate requests
+	ContentHash string `json:"-"`
 }
 
 type BlogPost struct {
-	Meta    BlogPostMeta
-	Content string
+	Meta        BlogPostMeta
+	Content     string
+	ContentHTML string `json:"contentHTML,omitempty"`
 }
 
 type ContentMeta struct {
-	Title     string    `yaml:"title"`
-	Published time.Time `yaml:"date"`
+	Title      string    `yaml:"title"`
+	Published  time.Time `yaml:"date"`
+	Tags       []string  `yaml:"tags"`
+	Categories []string  `yaml:"categories"`
+	Summary    string    `yaml:"summary"`
+	Draft      bool      `yaml:"draft"`
+}
+
+// metaVersion is bumped when more front matter is synced to the property template,
+// so that files synced by an older version are processed again
+const metaVersion = "3"
+
+func syncedHash(contentHash string) string {
+	return metaVersion + ":" + contentHash
+}
+
+// resubscribeDelay is how long to wait before subscribing again after the subscription failed
+const resubscribeDelay = 10 * time.Second
+
+func (dbx *DropboxBlog) subscribe(entriesChan chan<- dropbox.EntryMetadata) {
+	defer close(entriesChan)
+	for {
+		err := dbx.client.SubscribeMainFolder(entriesChan, dbx.syncRequests, dbx.done)
+		if err == nil {
+			return
+		}
+		slog.Warn("subscribing to the blog folder", slog.Duration("retry_in", resubscribeDelay), slog.Any("err", err))
+		select {
+		case <-dbx.done:
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
 }
 
 func (dbx *DropboxBlog) updateFileMetadata() {
 
-	doneChan := make(chan struct{})
-	entriesChan := make(chan dropbox.EntryMetadata)
+	// Syncing is canceled when the store is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
-		err := dbx.client.SubscribeMainFolder(entriesChan, doneChan)
-		if err != nil {
-			log.Println("subscribing to metadata failed", err)
+		select {
+		case <-dbx.done:
+			cancel()
+		case <-ctx.Done():
 		}
 	}()
 
+	// Properties not defined by the template are rejected, so the template is completed first
+	for {
+		err := dbx.client.EnsurePropertyTemplate(ctx)
+		if err == nil {
+			break
+		}
+		slog.WarnContext(ctx, "ensuring the property template", slog.Duration("retry_in", resubscribeDelay), slog.Any("err", err))
+		select {
+		case <-dbx.done:
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+
+	entriesChan := make(chan dropbox.EntryMetadata)
+	go dbx.subscribe(entriesChan)
+
 	for ent := range entriesChan {
 
+		if ent.Tag == "deleted" && path.Ext(ent.Name) == ".md" {
+			dbx.UpdatesChan <- dbx.client.GetID(ent)
+			continue
+		}
+		if !isPostEntry(ent) {
+			continue
+		}
 		am, err := dbx.client.AnachromeMeta(ent)
 		if err != nil {
-			log.Println("getting anachrome meta failed", err)
+			slog.WarnContext(ctx, "getting anachrome meta", slog.String("entry", ent.PathDisplay), slog.Any("err", err))
 			continue
 		}
-		if ent.ContentHash != am.Hash {
+		hash := syncedHash(ent.ContentHash)
+		if hash != am.Hash || ent.Relisted {
 			id := dbx.client.GetID(ent)
 
-			content, _, err := dbx.client.GetFileContent(context.Background(), id)
+			content, _, err := dbx.client.GetFileContent(ctx, id)
 			if err != nil {
-				log.Println("getting file content", err)
+				slog.WarnContext(ctx, "getting file content", slog.String("entry", ent.PathDisplay), slog.Any("err", err))
 				continue
 			}
 			meta, _, err := readAnachromeMetaFromContent(content)
 			if err != nil {
-				log.Println("reading anachrome meta", err)
+				slog.WarnContext(ctx, "reading anachrome meta", slog.String("entry", ent.PathDisplay), slog.Any("err", err))
 				continue
 			}
 
-			am.Title = meta.Title
-			am.Published = meta.Published
-			am.Hash = ent.ContentHash
+			meta.Hash = hash
 
-			err = dbx.client.UpdateEntryProperties(context.Background(), ent, am)
+			err = dbx.client.UpdateEntryProperties(ctx, ent, *meta)
 			if err != nil {
-				log.Println("updating anachrome meta", err)
+				slog.WarnContext(ctx, "updating anachrome meta", slog.String("entry", ent.PathDisplay), slog.Any("err", err))
 				continue
 			}
 			dbx.UpdatesChan <- id
@@ -87,20 +155,73 @@ func (dbx *DropboxBlog) updateFileMetadata() {
 	}
 }
 
+// isPostEntry reports if the folder entry is a post and not an asset or folder
+func isPostEntry(ent dropbox.EntryMetadata) bool {
+	return ent.Tag == "file" && path.Ext(ent.Name) == ".md"
+}
+
 // NewDropboxBlogStore creates a dropbox blog store and initializes a syncing client
-func NewDropboxBlogStore(client *http.Client, key, basePath, metadataID string) *DropboxBlog {
+func NewDropboxBlogStore(client *http.Client, key, basePath, metadataID string, opts ...dropbox.ClientOption) *DropboxBlog {
 
-	c := dropbox.NewClient(client, key, basePath, metadataID)
+	c := dropbox.NewClient(client, key, basePath, metadataID, opts...)
 	uc := make(chan string, 1)
 	dbxBlog := &DropboxBlog{
-		client:      c,
-		UpdatesChan: uc}
+		client:       c,
+		syncRequests: make(chan dropbox.SyncRequest, 1),
+		done:         make(chan struct{}),
+		UpdatesChan:  uc}
 
 	go dbxBlog.updateFileMetadata()
 	return dbxBlog
 }
 
-// GetBlogPostsMeta lists files metadata
+// RequestSync makes the store sync changes in the folder now instead of waiting for the longpoll
+func (dbx *DropboxBlog) RequestSync() {
+	dbx.requestSync(dropbox.SyncRequest{})
+}
+
+// Resync makes the store list the whole folder again and rewrite the metadata of every post
+func (dbx *DropboxBlog) Resync() {
+	dbx.requestSync(dropbox.SyncRequest{Full: true})
+}
+
+// requestSync queues the request, merged with the one already pending so that a full sync is not lost
+func (dbx *DropboxBlog) requestSync(req dropbox.SyncRequest) {
+	for {
+		select {
+		case dbx.syncRequests <- req:
+			return
+		default:
+		}
+		select {
+		case pending := <-dbx.syncRequests:
+			req.Full = req.Full || pending.Full
+		default:
+		}
+	}
+}
+
+// Close stops syncing the folder
+func (dbx *DropboxBlog) Close() error {
+	close(dbx.done)
+	return nil
+}
+
+// CheckToken reports if Dropbox accepts the access token
+func (dbx *DropboxBlog) CheckToken(ctx context.Context) error {
+	return dbx.client.CheckUser(ctx)
+}
+
+// CheckListed reports if the folder has been listed once since the store started,
+// before that posts may be missing or lack their metadata
+func (dbx *DropboxBlog) CheckListed(ctx context.Context) error {
+	if !dbx.client.Listed() {
+		return errors.New("folder not listed yet")
+	}
+	return nil
+}
+
+// GetBlogPostsMeta lists files metadata, including drafts and scheduled posts
 func (dbx *DropboxBlog) GetBlogPostsMeta(ctx context.Context) ([]BlogPostMeta, error) {
 	meta := make([]BlogPostMeta, 0)
 	folder, err := dbx.client.ListMainFolder(ctx)
@@ -110,25 +231,43 @@ func (dbx *DropboxBlog) GetBlogPostsMeta(ctx context.Context) ([]BlogPostMeta, e
 	}
 	for _, ent := range folder.Entries {
 
+		if !isPostEntry(ent) {
+			continue
+		}
 		am, err := dbx.client.AnachromeMeta(ent)
 		if err != nil {
 			return nil, err
 		}
-		if am.Published.Sub(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).Hours() < 0 {
+		// The metadata of new files is synced from their front matter in the background
+		if len(am.Hash) == 0 {
 			continue
 		}
 
 		meta = append(meta, BlogPostMeta{
-			Title:     am.Title,
-			Published: am.Published,
-			ID:        dbx.client.GetID(ent),
-			Updated:   ent.ClientModified,
+			Title:       am.Title,
+			Published:   am.Published,
+			ID:          dbx.client.GetID(ent),
+			Updated:     ent.ClientModified,
+			Tags:        am.Tags,
+			Categories:  am.Categories,
+			Summary:     am.Summary,
+			Draft:       am.Draft,
+			ContentHash: ent.ContentHash,
 		})
 	}
 	return meta, nil
 
 }
 
+// GetBlogPostsPage lists a page of the posts in the folder
+func (dbx *DropboxBlog) GetBlogPostsPage(ctx context.Context, opts ListOptions) (BlogPostsPage, error) {
+	metas, err := dbx.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return BlogPostsPage{}, err
+	}
+	return PageOf(metas, opts)
+}
+
 func readAnachromeMetaFromContent(content []byte) (*dropbox.AnachromeMeta, int, error) {
 	if len(content) < 8 {
 		return nil, -1, fmt.Errorf("content to short to include metadata")
@@ -152,21 +291,33 @@ func readAnachromeMetaFromContent(content []byte) (*dropbox.AnachromeMeta, int,
 		return nil, idx + 4, fmt.Errorf("cannot unmarshal data %w", err)
 	}
 	return &dropbox.AnachromeMeta{
-		Title:     c.Title,
-		Published: c.Published,
+		Title:      c.Title,
+		Published:  c.Published,
+		Tags:       c.Tags,
+		Categories: c.Categories,
+		Summary:    c.Summary,
+		Draft:      c.Draft,
 	}, idx + 7, nil
 }
 
 func (dbx *DropboxBlog) GetBlogPost(ctx context.Context, id string) (BlogPost, error) {
 
 	content, filemeta, err := dbx.client.GetFileContent(ctx, id)
-	blogPost := BlogPost{}
+	if dropbox.IsNotFound(err) {
+		return BlogPost{}, ErrPostNotFound
+	}
 	if err != nil {
-		return blogPost, err
-
+		return BlogPost{}, err
 	}
 
-	blogPost.Meta.ID = dbx.client.GetID(*filemeta)
+	return blogPostFromContent(dbx.client.GetID(*filemeta), content, filemeta.ClientModified, filemeta.ContentHash)
+}
+
+func blogPostFromContent(id string, content []byte, updated time.Time, contentHash string) (BlogPost, error) {
+
+	blogPost := BlogPost{}
+	blogPost.Meta.ID = id
+	blogPost.Meta.ContentHash = contentHash
 
 	meta, contentStart, err := readAnachromeMetaFromContent(content)
 	if err != nil {
@@ -175,7 +326,33 @@ func (dbx *DropboxBlog) GetBlogPost(ctx context.Context, id string) (BlogPost, e
 	blogPost.Content = strings.TrimSpace(string(content[contentStart:]))
 	blogPost.Meta.Title = meta.Title
 	blogPost.Meta.Published = meta.Published
-	blogPost.Meta.Updated = filemeta.ClientModified
+	blogPost.Meta.Updated = updated
+	blogPost.Meta.Tags = meta.Tags
+	blogPost.Meta.Categories = meta.Categories
+	blogPost.Meta.Summary = meta.Summary
+	blogPost.Meta.Draft = meta.Draft
 
 	return blogPost, nil
 }
+
+// GetAsset streams a file from the Dropbox folder
+func (dbx *DropboxBlog) GetAsset(ctx context.Context, name string) (Asset, error) {
+
+	if !ValidAssetName(name) {
+		return Asset{}, ErrAssetNotFound
+	}
+	content, filemeta, err := dbx.client.DownloadFile(ctx, name)
+	if dropbox.IsNotFound(err) {
+		return Asset{}, ErrAssetNotFound
+	}
+	if err != nil {
+		return Asset{}, err
+	}
+	return Asset{
+		Name:        name,
+		ContentHash: filemeta.ContentHash,
+		Size:        int64(filemeta.Size),
+		Modified:    filemeta.ServerModified,
+		Content:     content,
+	}, nil
+}
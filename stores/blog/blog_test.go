@@ -29,6 +29,20 @@ func Test_readAnachromeMetaFromContent(t *testing.T) {
 			36,
 			false,
 		},
+		{
+			"Should return tags, categories, summary and draft",
+			[]byte("---\ndate: 2021-03-17\ntitle: Test\ntags: [go, web]\ncategories:\n  - programming\nsummary: A test\ndraft: true\n---\n"),
+			&dropbox.AnachromeMeta{
+				Title:      "Test",
+				Published:  time.Date(2021, 3, 17, 0, 0, 0, 0, time.UTC),
+				Tags:       []string{"go", "web"},
+				Categories: []string{"programming"},
+				Summary:    "A test",
+				Draft:      true,
+			},
+			108,
+			false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
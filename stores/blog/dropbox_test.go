@@ -0,0 +1,269 @@
+package blog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/stores/dropbox"
+)
+
+const fakeTemplateID = "ptid:fake"
+
+// fakeDropbox serves the parts of the Dropbox API the blog store uses from files in memory
+type fakeDropbox struct {
+	mu         sync.Mutex
+	files      map[string]string
+	properties map[string][]fakeField
+	// template holds the field names defined by the property template
+	template []string
+}
+
+// fits reports whether the property template defines every field
+func (fd *fakeDropbox) fits(fields []fakeField) bool {
+	for _, f := range fields {
+		if !slices.Contains(fd.template, f.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+type fakeField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type fakeGroup struct {
+	TemplateID        string      `json:"template_id"`
+	Fields            []fakeField `json:"fields,omitempty"`
+	AddOrUpdateFields []fakeField `json:"add_or_update_fields,omitempty"`
+}
+
+type fakeEntry struct {
+	Tag            string      `json:".tag"`
+	Name           string      `json:"name"`
+	PathLower      string      `json:"path_lower"`
+	ClientModified time.Time   `json:"client_modified"`
+	ContentHash    string      `json:"content_hash"`
+	PropertyGroups []fakeGroup `json:"property_groups"`
+}
+
+func (fd *fakeDropbox) entry(p string) fakeEntry {
+	sum := sha256.Sum256([]byte(fd.files[p]))
+	ent := fakeEntry{
+		Tag:            "file",
+		Name:           path.Base(p),
+		PathLower:      p,
+		ClientModified: time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC),
+		ContentHash:    hex.EncodeToString(sum[:]),
+		PropertyGroups: []fakeGroup{},
+	}
+	if fields, ok := fd.properties[p]; ok {
+		ent.PropertyGroups = append(ent.PropertyGroups, fakeGroup{TemplateID: fakeTemplateID, Fields: fields})
+	}
+	return ent
+}
+
+func (fd *fakeDropbox) handler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /2/files/list_folder", func(w http.ResponseWriter, r *http.Request) {
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		entries := []fakeEntry{}
+		for p := range fd.files {
+			entries = append(entries, fd.entry(p))
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		json.NewEncoder(w).Encode(map[string]any{"entries": entries, "cursor": "end", "has_more": false})
+	})
+	mux.HandleFunc("POST /2/files/list_folder/longpoll", func(w http.ResponseWriter, r *http.Request) {
+		// A short timeout without changes
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"changes": false}`))
+	})
+	mux.HandleFunc("POST /2/files/download", func(w http.ResponseWriter, r *http.Request) {
+		var arg struct{ Path string }
+		if err := json.Unmarshal([]byte(r.Header.Get("Dropbox-API-Arg")), &arg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		content, ok := fd.files[arg.Path]
+		if !ok {
+			http.Error(w, `{"error_summary": "path/not_found/"}`, http.StatusConflict)
+			return
+		}
+		result, _ := json.Marshal(fd.entry(arg.Path))
+		w.Header().Set("Dropbox-API-Result", string(result))
+		w.Write([]byte(content))
+	})
+	mux.HandleFunc("POST /2/file_properties/properties/{mode}", func(w http.ResponseWriter, r *http.Request) {
+		var arg struct {
+			Path                 string      `json:"path"`
+			PropertyGroups       []fakeGroup `json:"property_groups"`
+			UpdatePropertyGroups []fakeGroup `json:"update_property_groups"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		var fields []fakeField
+		switch r.PathValue("mode") {
+		case "add":
+			fields = arg.PropertyGroups[0].Fields
+		case "update":
+			fields = arg.UpdatePropertyGroups[0].AddOrUpdateFields
+		}
+		if !fd.fits(fields) {
+			http.Error(w, `{"error_summary": "does_not_fit_template/"}`, http.StatusConflict)
+			return
+		}
+		fd.properties[arg.Path] = fields
+		w.Write([]byte("null"))
+	})
+	mux.HandleFunc("POST /2/file_properties/templates/get_for_user", func(w http.ResponseWriter, r *http.Request) {
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		fields := []map[string]any{}
+		for _, name := range fd.template {
+			fields = append(fields, map[string]any{"name": name, "description": name, "type": map[string]string{".tag": "string"}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "Anachrome", "description": "", "fields": fields})
+	})
+	mux.HandleFunc("POST /2/file_properties/templates/update_for_user", func(w http.ResponseWriter, r *http.Request) {
+		var arg struct {
+			TemplateID string `json:"template_id"`
+			AddFields  []struct {
+				Name string `json:"name"`
+			} `json:"add_fields"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		for _, f := range arg.AddFields {
+			fd.template = append(fd.template, f.Name)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"template_id": arg.TemplateID})
+	})
+	return mux
+}
+
+func TestDropboxBlog(t *testing.T) {
+
+	fd := &fakeDropbox{
+		files: map[string]string{
+			"/blog/hello.md": "---\ntitle: Hello\ndate: 2021-03-18\ntags: [go, \"hello, world\"]\n---\n\nHello from Dropbox\n",
+			"/blog/draft.md": "---\ntitle: Draft\ndate: 2021-03-19\ndraft: true\n---\n\nNot yet\n",
+			"/blog/cat.png":  "PNG",
+		},
+		properties: map[string][]fakeField{},
+		// A template created by an older version
+		template: []string{"title", "published", "hash"},
+	}
+	srv := httptest.NewServer(fd.handler())
+	defer srv.Close()
+
+	dbx := NewDropboxBlogStore(srv.Client(), "key", "/blog", fakeTemplateID,
+		dropbox.WithAPIURL(srv.URL),
+		dropbox.WithContentURL(srv.URL),
+		dropbox.WithNotifyURL(srv.URL))
+	defer dbx.Close()
+
+	synced := map[string]bool{}
+	for len(synced) < 2 {
+		select {
+		case id := <-dbx.UpdatesChan:
+			synced[id] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out syncing metadata, synced %v", synced)
+		}
+	}
+
+	ctx := context.Background()
+	metas, err := dbx.GetBlogPostsMeta(ctx)
+	if err != nil {
+		t.Fatalf("GetBlogPostsMeta() error = %v", err)
+	}
+	// Drafts are listed, they are hidden by the published blog store
+	assert.ElementsMatch(t, []BlogPostMeta{{
+		Title:       "Hello",
+		ID:          "hello",
+		Published:   time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC),
+		Updated:     time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC),
+		Tags:        []string{"go", "hello, world"},
+		ContentHash: fd.entry("/blog/hello.md").ContentHash,
+	}, {
+		Title:       "Draft",
+		ID:          "draft",
+		Published:   time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC),
+		Updated:     time.Date(2021, 3, 18, 10, 27, 0, 0, time.UTC),
+		Draft:       true,
+		ContentHash: fd.entry("/blog/draft.md").ContentHash,
+	}}, metas)
+
+	post, err := dbx.GetBlogPost(ctx, "hello")
+	if err != nil {
+		t.Fatalf("GetBlogPost() error = %v", err)
+	}
+	assert.Equal(t, "Hello from Dropbox", post.Content)
+	assert.Equal(t, fd.entry("/blog/hello.md").ContentHash, post.Meta.ContentHash)
+
+	_, err = dbx.GetBlogPost(ctx, "missing")
+	assert.ErrorIs(t, err, ErrPostNotFound)
+
+	asset, err := dbx.GetAsset(ctx, "cat.png")
+	if err != nil {
+		t.Fatalf("GetAsset() error = %v", err)
+	}
+	defer asset.Content.Close()
+	b, err := io.ReadAll(asset.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "PNG", string(b))
+	assert.Equal(t, fd.entry("/blog/cat.png").ContentHash, asset.ContentHash)
+
+	_, err = dbx.GetAsset(ctx, "dog.png")
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+
+	// A resync rewrites metadata that is stale although the hash matches
+	fd.mu.Lock()
+	for i, f := range fd.properties["/blog/hello.md"] {
+		if f.Name == "title" {
+			fd.properties["/blog/hello.md"][i].Value = "Stale"
+		}
+	}
+	fd.mu.Unlock()
+	dbx.Resync()
+	for range 2 {
+		select {
+		case <-dbx.UpdatesChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out resyncing metadata")
+		}
+	}
+	metas, err = dbx.GetBlogPostsMeta(ctx)
+	if err != nil {
+		t.Fatalf("GetBlogPostsMeta() error = %v", err)
+	}
+	assert.True(t, slices.ContainsFunc(metas, func(m BlogPostMeta) bool { return m.Title == "Hello" }), "metadata is rewritten")
+}
@@ -0,0 +1,392 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+type GitBlog struct {
+	repoPath    string
+	branch      string
+	dir         string
+	done        chan struct{}
+	UpdatesChan chan string
+}
+
+// NewGitBlogStore creates a blog store reading markdown files from a directory on a branch
+// of a bare or working git repository, polling the branch for new commits
+func NewGitBlogStore(repoPath, branch, dir string, pollInterval time.Duration) (*GitBlog, error) {
+
+	if branch == "" {
+		branch = "main"
+	}
+	if pollInterval <= 0 {
+		pollInterval = 30 * time.Second
+	}
+
+	gb := &GitBlog{
+		repoPath:    repoPath,
+		branch:      branch,
+		dir:         strings.Trim(dir, "/"),
+		done:        make(chan struct{}),
+		UpdatesChan: make(chan string, 1)}
+
+	repo, err := gb.open()
+	if err != nil {
+		return nil, err
+	}
+	head, err := gb.headCommit(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	go gb.pollCommits(pollInterval, head.Hash)
+	return gb, nil
+}
+
+func (gb *GitBlog) open() (*git.Repository, error) {
+	repo, err := git.PlainOpen(gb.repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening git repository: %w", err)
+	}
+	return repo, nil
+}
+
+func (gb *GitBlog) headCommit(repo *git.Repository) (*object.Commit, error) {
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(gb.branch), true)
+	if err != nil {
+		return nil, fmt.Errorf("resolving branch %s: %w", gb.branch, err)
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("reading commit %s: %w", ref.Hash(), err)
+	}
+	return commit, nil
+}
+
+func (gb *GitBlog) postsTree(commit *object.Commit) (*object.Tree, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("reading tree of %s: %w", commit.Hash, err)
+	}
+	if gb.dir == "" {
+		return tree, nil
+	}
+	tree, err = tree.Tree(gb.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory %s: %w", gb.dir, err)
+	}
+	return tree, nil
+}
+
+func (gb *GitBlog) pollCommits(interval time.Duration, last plumbing.Hash) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gb.done:
+			return
+		case <-ticker.C:
+		}
+
+		repo, err := gb.open()
+		if err != nil {
+			slog.Warn("polling git repository", slog.String("repo", gb.repoPath), slog.Any("err", err))
+			continue
+		}
+		head, err := gb.headCommit(repo)
+		if err != nil {
+			slog.Warn("polling git repository", slog.String("repo", gb.repoPath), slog.Any("err", err))
+			continue
+		}
+		if head.Hash == last {
+			continue
+		}
+
+		ids, err := gb.changedPosts(repo, last, head)
+		if err != nil {
+			slog.Warn("diffing git commits", slog.String("repo", gb.repoPath), slog.Any("err", err))
+			continue
+		}
+		last = head.Hash
+		for _, id := range ids {
+			gb.UpdatesChan <- id
+		}
+	}
+}
+
+func (gb *GitBlog) changedPosts(repo *git.Repository, from plumbing.Hash, to *object.Commit) ([]string, error) {
+
+	newTree, err := gb.postsTree(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldTree *object.Tree
+	oldCommit, err := repo.CommitObject(from)
+	if err == nil {
+		oldTree, err = gb.postsTree(oldCommit)
+	}
+	if err != nil {
+		// The previous commit or directory is gone, so every post may have changed
+		oldTree = &object.Tree{}
+	}
+
+	changes, err := object.DiffTree(oldTree, newTree)
+	if err != nil {
+		return nil, fmt.Errorf("diffing trees: %w", err)
+	}
+
+	ids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name == "" || strings.Contains(name, "/") || path.Ext(name) != ".md" {
+				continue
+			}
+			id := strings.TrimSuffix(name, ".md")
+			if len(ids) == 0 || ids[len(ids)-1] != id {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Close stops polling the repository
+func (gb *GitBlog) Close() error {
+	close(gb.done)
+	return nil
+}
+
+func (gb *GitBlog) lastModified(repo *git.Repository, commit *object.Commit, filePath string) (time.Time, error) {
+
+	iter, err := repo.Log(&git.LogOptions{From: commit.Hash, FileName: &filePath})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading history of %s: %w", filePath, err)
+	}
+	defer iter.Close()
+
+	c, err := iter.Next()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading history of %s: %w", filePath, err)
+	}
+	return c.Committer.When.UTC(), nil
+}
+
+func (gb *GitBlog) readPost(repo *git.Repository, commit *object.Commit, tree *object.Tree, id string) (BlogPost, error) {
+
+	f, err := tree.File(id + ".md")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return BlogPost{}, ErrPostNotFound
+	}
+	if err != nil {
+		return BlogPost{}, fmt.Errorf("reading blog post %s: %w", id, err)
+	}
+	updated, err := gb.lastModified(repo, commit, path.Join(gb.dir, f.Name))
+	if err != nil {
+		return BlogPost{}, err
+	}
+	return postFromFile(f, id, updated)
+}
+
+// postFromFile reads the post in the file, which last changed at updated
+func postFromFile(f *object.File, id string, updated time.Time) (BlogPost, error) {
+
+	content, err := f.Contents()
+	if err != nil {
+		return BlogPost{}, fmt.Errorf("reading blog post %s: %w", id, err)
+	}
+	return blogPostFromContent(id, []byte(content), updated, f.Hash.String())
+}
+
+// modifiedTimes finds when the named files of the posts directory last changed, walking the
+// history once for all of them instead of once per file like lastModified
+func (gb *GitBlog) modifiedTimes(repo *git.Repository, head *object.Commit, names []string) (map[string]time.Time, error) {
+
+	pending := make(map[string]bool, len(names))
+	for _, name := range names {
+		pending[name] = true
+	}
+	times := make(map[string]time.Time, len(names))
+
+	// The blobs of the posts directory by commit, kept until the commit is visited
+	blobs := map[plumbing.Hash]map[string]plumbing.Hash{}
+	entries := func(c *object.Commit) map[string]plumbing.Hash {
+		if e, ok := blobs[c.Hash]; ok {
+			return e
+		}
+		e := map[string]plumbing.Hash{}
+		if tree, err := gb.postsTree(c); err == nil {
+			for _, ent := range tree.Entries {
+				e[ent.Name] = ent.Hash
+			}
+		}
+		blobs[c.Hash] = e
+		return e
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash})
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	defer iter.Close()
+
+	err = iter.ForEach(func(c *object.Commit) error {
+		current := entries(c)
+		delete(blobs, c.Hash)
+		var parents []map[string]plumbing.Hash
+		err := c.Parents().ForEach(func(p *object.Commit) error {
+			parents = append(parents, entries(p))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for name := range pending {
+			// The commit changed the file unless a parent has the same version
+			if !slices.ContainsFunc(parents, func(p map[string]plumbing.Hash) bool {
+				h, ok := p[name]
+				return ok && h == current[name]
+			}) {
+				times[name] = c.Committer.When.UTC()
+				delete(pending, name)
+			}
+		}
+		if len(pending) == 0 {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	return times, nil
+}
+
+// GetBlogPostsMeta lists metadata of the markdown files on the configured branch
+func (gb *GitBlog) GetBlogPostsMeta(ctx context.Context) ([]BlogPostMeta, error) {
+
+	repo, err := gb.open()
+	if err != nil {
+		return nil, err
+	}
+	head, err := gb.headCommit(repo)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := gb.postsTree(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, ent := range tree.Entries {
+		if ent.Mode.IsFile() && path.Ext(ent.Name) == ".md" {
+			names = append(names, ent.Name)
+		}
+	}
+	modified, err := gb.modifiedTimes(repo, head, names)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make([]BlogPostMeta, 0)
+	for _, name := range names {
+		id := strings.TrimSuffix(name, ".md")
+		f, err := tree.File(name)
+		if err != nil {
+			slog.WarnContext(ctx, "reading blog post", slog.String("id", id), slog.Any("err", err))
+			continue
+		}
+		post, err := postFromFile(f, id, modified[name])
+		if err != nil {
+			slog.WarnContext(ctx, "reading blog post", slog.String("id", id), slog.Any("err", err))
+			continue
+		}
+		meta = append(meta, post.Meta)
+	}
+	return meta, nil
+}
+
+// GetBlogPostsPage lists a page of the posts on the configured branch
+func (gb *GitBlog) GetBlogPostsPage(ctx context.Context, opts ListOptions) (BlogPostsPage, error) {
+	metas, err := gb.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return BlogPostsPage{}, err
+	}
+	return PageOf(metas, opts)
+}
+
+func (gb *GitBlog) GetBlogPost(ctx context.Context, id string) (BlogPost, error) {
+
+	if !validPostID(id) {
+		return BlogPost{}, ErrPostNotFound
+	}
+	repo, err := gb.open()
+	if err != nil {
+		return BlogPost{}, err
+	}
+	head, err := gb.headCommit(repo)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	tree, err := gb.postsTree(head)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	return gb.readPost(repo, head, tree, id)
+}
+
+// GetAsset reads a file in the posts directory on the configured branch
+func (gb *GitBlog) GetAsset(ctx context.Context, name string) (Asset, error) {
+
+	if !ValidAssetName(name) {
+		return Asset{}, ErrAssetNotFound
+	}
+	repo, err := gb.open()
+	if err != nil {
+		return Asset{}, err
+	}
+	head, err := gb.headCommit(repo)
+	if err != nil {
+		return Asset{}, err
+	}
+	tree, err := gb.postsTree(head)
+	if err != nil {
+		return Asset{}, err
+	}
+	f, err := tree.File(name)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return Asset{}, ErrAssetNotFound
+	}
+	if err != nil {
+		return Asset{}, fmt.Errorf("reading asset %s: %w", name, err)
+	}
+	modified, err := gb.lastModified(repo, head, path.Join(gb.dir, name))
+	if err != nil {
+		return Asset{}, err
+	}
+	content, err := f.Reader()
+	if err != nil {
+		return Asset{}, fmt.Errorf("reading asset %s: %w", name, err)
+	}
+	return Asset{
+		Name:        name,
+		ContentHash: f.Hash.String(),
+		Size:        f.Size,
+		Modified:    modified,
+		Content:     content,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package blog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixtureRepo struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+}
+
+func newFixtureRepo(t *testing.T) *fixtureRepo {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	if err != nil {
+		t.Fatalf("initializing fixture repository: %v", err)
+	}
+	return &fixtureRepo{t, dir, repo}
+}
+
+func (fr *fixtureRepo) commit(when time.Time, files map[string]string) {
+	fr.t.Helper()
+	wt, err := fr.repo.Worktree()
+	if err != nil {
+		fr.t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(fr.dir, name)
+		if content == "" {
+			_, err = wt.Remove(name)
+		} else {
+			err = os.MkdirAll(filepath.Dir(p), 0o755)
+			if err == nil {
+				err = os.WriteFile(p, []byte(content), 0o644)
+			}
+			if err == nil {
+				_, err = wt.Add(name)
+			}
+		}
+		if err != nil {
+			fr.t.Fatalf("staging %s: %v", name, err)
+		}
+	}
+	sig := &object.Signature{Name: "Writer", Email: "writer@example.com", When: when}
+	_, err = wt.Commit("update posts", &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		fr.t.Fatalf("committing: %v", err)
+	}
+}
+
+func TestGitBlog(t *testing.T) {
+
+	firstCommit := time.Date(2021, 3, 17, 12, 0, 0, 0, time.UTC)
+	secondCommit := time.Date(2021, 3, 18, 12, 0, 0, 0, time.UTC)
+
+	fr := newFixtureRepo(t)
+	fr.commit(firstCommit, map[string]string{
+		"posts/foo.md":  "---\ndate: 2021-03-17\ntitle: Foo\n---\nFoo text\n",
+		"posts/bar.md":  "---\ndate: 2021-03-16\ntitle: Bar\n---\nBar text\n",
+		"README.md":     "Not a post",
+		"posts/img.png": "png",
+	})
+	fr.commit(secondCommit, map[string]string{
+		"posts/bar.md": "---\ndate: 2021-03-16\ntitle: Bar\n---\nBar text, edited\n",
+	})
+
+	gb, err := NewGitBlogStore(fr.dir, "main", "/posts/", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("creating git blog store: %v", err)
+	}
+	defer func() {
+		_ = gb.Close()
+	}()
+
+	metas, err := gb.GetBlogPostsMeta(context.Background())
+	if err != nil {
+		t.Fatalf("listing posts: %v", err)
+	}
+	blobHash := func(content string) string {
+		return plumbing.ComputeHash(plumbing.BlobObject, []byte(content)).String()
+	}
+	assert.Equal(t, []BlogPostMeta{
+		{Title: "Bar", ID: "bar", Published: time.Date(2021, 3, 16, 0, 0, 0, 0, time.UTC), Updated: secondCommit,
+			ContentHash: blobHash("---\ndate: 2021-03-16\ntitle: Bar\n---\nBar text, edited\n")},
+		{Title: "Foo", ID: "foo", Published: time.Date(2021, 3, 17, 0, 0, 0, 0, time.UTC), Updated: firstCommit,
+			ContentHash: blobHash("---\ndate: 2021-03-17\ntitle: Foo\n---\nFoo text\n")},
+	}, metas)
+
+	post, err := gb.GetBlogPost(context.Background(), "bar")
+	if err != nil {
+		t.Fatalf("getting post: %v", err)
+	}
+	assert.Equal(t, "Bar text, edited", post.Content)
+
+	for _, id := range []string{"", "../README", "missing"} {
+		_, err = gb.GetBlogPost(context.Background(), id)
+		assert.ErrorIs(t, err, ErrPostNotFound, id)
+	}
+
+	fr.commit(time.Date(2021, 3, 19, 12, 0, 0, 0, time.UTC), map[string]string{
+		"posts/baz.md": "---\ndate: 2021-03-19\ntitle: Baz\n---\nBaz text\n",
+	})
+	waitForUpdate(t, gb.UpdatesChan, "baz")
+
+	fr.commit(time.Date(2021, 3, 20, 12, 0, 0, 0, time.UTC), map[string]string{
+		"posts/foo.md": "",
+	})
+	waitForUpdate(t, gb.UpdatesChan, "foo")
+
+	_, err = gb.GetBlogPost(context.Background(), "foo")
+	if err == nil {
+		t.Errorf("deleted post should not be found")
+	}
+
+	// Listed posts changed when their last commit did, like single posts
+	metas, err = gb.GetBlogPostsMeta(context.Background())
+	if err != nil {
+		t.Fatalf("listing posts: %v", err)
+	}
+	updated := map[string]time.Time{}
+	for _, meta := range metas {
+		updated[meta.ID] = meta.Updated
+	}
+	assert.Equal(t, map[string]time.Time{
+		"bar": secondCommit,
+		"baz": time.Date(2021, 3, 19, 12, 0, 0, 0, time.UTC),
+	}, updated)
+	post, err = gb.GetBlogPost(context.Background(), "baz")
+	if err != nil {
+		t.Fatalf("getting post: %v", err)
+	}
+	assert.Equal(t, updated["baz"], post.Meta.Updated)
+}
+
+func TestNewGitBlogStoreMissingBranch(t *testing.T) {
+
+	fr := newFixtureRepo(t)
+	fr.commit(time.Now(), map[string]string{"foo.md": "---\ndate: 2021-03-17\ntitle: Foo\n---\n"})
+
+	_, err := NewGitBlogStore(fr.dir, "drafts", "", time.Second)
+	if err == nil {
+		t.Errorf("opening a missing branch should fail")
+	}
+}
@@ -0,0 +1,170 @@
+package blog
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type LocalBlog struct {
+	dir         string
+	watcher     *fsnotify.Watcher
+	UpdatesChan chan string
+}
+
+// NewLocalBlogStore creates a blog store reading markdown files from dir and watches it for changes
+func NewLocalBlogStore(dir string) (*LocalBlog, error) {
+
+	if dir == "" {
+		return nil, fmt.Errorf("cannot create local blog store without a directory")
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("opening blog directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating watcher: %w", err)
+	}
+	err = w.Add(dir)
+	if err != nil {
+		return nil, fmt.Errorf("watching blog directory: %w", err)
+	}
+
+	lb := &LocalBlog{
+		dir:         dir,
+		watcher:     w,
+		UpdatesChan: make(chan string, 1)}
+
+	go lb.watchFiles()
+	return lb, nil
+}
+
+func (lb *LocalBlog) watchFiles() {
+	for {
+		select {
+		case ev, ok := <-lb.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Ext(ev.Name) != ".md" {
+				continue
+			}
+			if ev.Has(fsnotify.Create) ||
+				ev.Has(fsnotify.Write) ||
+				ev.Has(fsnotify.Remove) ||
+				ev.Has(fsnotify.Rename) {
+				lb.UpdatesChan <- strings.TrimSuffix(filepath.Base(ev.Name), ".md")
+			}
+		case err, ok := <-lb.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("watching blog directory", slog.String("dir", lb.dir), slog.Any("err", err))
+		}
+	}
+}
+
+// Close stops watching the blog directory
+func (lb *LocalBlog) Close() error {
+	return lb.watcher.Close()
+}
+
+// GetBlogPostsMeta lists metadata of the markdown files in the blog directory
+func (lb *LocalBlog) GetBlogPostsMeta(ctx context.Context) ([]BlogPostMeta, error) {
+	meta := make([]BlogPostMeta, 0)
+	entries, err := os.ReadDir(lb.dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing blog directory: %w", err)
+	}
+	for _, ent := range entries {
+		if ent.IsDir() || filepath.Ext(ent.Name()) != ".md" {
+			continue
+		}
+		id := strings.TrimSuffix(ent.Name(), ".md")
+		post, err := lb.GetBlogPost(ctx, id)
+		if err != nil {
+			slog.WarnContext(ctx, "reading blog post", slog.String("id", id), slog.Any("err", err))
+			continue
+		}
+		meta = append(meta, post.Meta)
+	}
+	return meta, nil
+}
+
+// GetBlogPostsPage lists a page of the posts on the blog directory
+func (lb *LocalBlog) GetBlogPostsPage(ctx context.Context, opts ListOptions) (BlogPostsPage, error) {
+	metas, err := lb.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return BlogPostsPage{}, err
+	}
+	return PageOf(metas, opts)
+}
+
+func (lb *LocalBlog) GetBlogPost(ctx context.Context, id string) (BlogPost, error) {
+
+	if !validPostID(id) {
+		return BlogPost{}, ErrPostNotFound
+	}
+	path := filepath.Join(lb.dir, id+".md")
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlogPost{}, ErrPostNotFound
+	}
+	if err != nil {
+		return BlogPost{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return BlogPost{}, err
+	}
+
+	return blogPostFromContent(id, content, info.ModTime(), fmt.Sprintf("%x", sha256.Sum256(content)))
+}
+
+// GetAsset opens a file in the blog directory
+func (lb *LocalBlog) GetAsset(ctx context.Context, name string) (Asset, error) {
+
+	if !ValidAssetName(name) {
+		return Asset{}, ErrAssetNotFound
+	}
+	f, err := os.Open(filepath.Join(lb.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Asset{}, ErrAssetNotFound
+	}
+	if err != nil {
+		return Asset{}, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = ErrAssetNotFound
+	}
+	if err != nil {
+		_ = f.Close()
+		return Asset{}, err
+	}
+	return Asset{
+		Name: name,
+		// Hashing the file on every request is too slow, its size and time change with the content
+		ContentHash: fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		Size:        info.Size(),
+		Modified:    info.ModTime(),
+		Content:     f,
+	}, nil
+}
+
+func validPostID(id string) bool {
+	return id != "" && id == filepath.Base(id) && !strings.HasPrefix(id, ".")
+}
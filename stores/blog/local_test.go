@@ -0,0 +1,130 @@
+package blog
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePost(t *testing.T, dir, id, content string) {
+	t.Helper()
+	err := os.WriteFile(filepath.Join(dir, id+".md"), []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("writing post %s: %v", id, err)
+	}
+}
+
+func waitForUpdate(t *testing.T, updates <-chan string, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case id := <-updates:
+			if id == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no update for %s", want)
+		}
+	}
+}
+
+func TestLocalBlog(t *testing.T) {
+
+	dir := t.TempDir()
+	writePost(t, dir, "foo", "---\ndate: 2021-03-17\ntitle: Foo\n---\nFoo text\n")
+	writePost(t, dir, "nometa", "No front matter here")
+	err := os.WriteFile(filepath.Join(dir, "image.png"), []byte{}, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lb, err := NewLocalBlogStore(dir)
+	if err != nil {
+		t.Fatalf("creating local blog store: %v", err)
+	}
+	defer func() {
+		_ = lb.Close()
+	}()
+
+	metas, err := lb.GetBlogPostsMeta(context.Background())
+	if err != nil {
+		t.Fatalf("listing posts: %v", err)
+	}
+	assert.Len(t, metas, 1)
+	assert.Equal(t, "foo", metas[0].ID)
+	assert.Equal(t, "Foo", metas[0].Title)
+	assert.Equal(t, time.Date(2021, 3, 17, 0, 0, 0, 0, time.UTC), metas[0].Published)
+
+	post, err := lb.GetBlogPost(context.Background(), "foo")
+	if err != nil {
+		t.Fatalf("getting post: %v", err)
+	}
+	assert.Equal(t, "Foo text", post.Content)
+
+	for _, id := range []string{"", "../foo", ".hidden", "missing"} {
+		_, err = lb.GetBlogPost(context.Background(), id)
+		assert.ErrorIs(t, err, ErrPostNotFound, id)
+	}
+
+	writePost(t, dir, "bar", "---\ndate: 2021-03-18\ntitle: Bar\n---\nBar text\n")
+	waitForUpdate(t, lb.UpdatesChan, "bar")
+
+	err = os.Remove(filepath.Join(dir, "foo.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForUpdate(t, lb.UpdatesChan, "foo")
+
+	metas, err = lb.GetBlogPostsMeta(context.Background())
+	if err != nil {
+		t.Fatalf("listing posts: %v", err)
+	}
+	assert.Len(t, metas, 1)
+	assert.Equal(t, "bar", metas[0].ID)
+}
+
+func TestLocalBlogAssets(t *testing.T) {
+
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "img"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "img", "cat.png"), []byte("PNG"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePost(t, dir, "foo", "---\ndate: 2021-03-17\ntitle: Foo\n---\nFoo text\n")
+
+	lb, err := NewLocalBlogStore(dir)
+	if err != nil {
+		t.Fatalf("creating local blog store: %v", err)
+	}
+	defer func() {
+		_ = lb.Close()
+	}()
+
+	asset, err := lb.GetAsset(context.Background(), "img/cat.png")
+	if err != nil {
+		t.Fatalf("GetAsset() error = %v", err)
+	}
+	b, err := io.ReadAll(asset.Content)
+	_ = asset.Content.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "PNG", string(b))
+	assert.Equal(t, int64(3), asset.Size)
+	assert.NotEmpty(t, asset.ContentHash)
+
+	for _, name := range []string{"img", "img/dog.png", "foo.md", "../cat.png"} {
+		_, err = lb.GetAsset(context.Background(), name)
+		assert.ErrorIs(t, err, ErrAssetNotFound, name)
+	}
+}
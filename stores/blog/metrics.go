@@ -0,0 +1,15 @@
+package blog
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// PendingUpdates reports the updates waiting in the channel of a blog store,
+// a growing number means the caches fall behind the backend
+func PendingUpdates(updates <-chan string) prometheus.Collector {
+
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "anachrome_blog_pending_updates",
+		Help: "Updated posts waiting to be invalidated in the caches.",
+	}, func() float64 {
+		return float64(len(updates))
+	})
+}
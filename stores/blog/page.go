@@ -0,0 +1,223 @@
+package blog
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type SortOrder string
+
+const (
+	// SortPublished lists the most recently published posts first
+	SortPublished SortOrder = "published"
+	// SortUpdated lists the most recently updated posts first
+	SortUpdated SortOrder = "updated"
+	// SortTitle lists posts alphabetically by title
+	SortTitle SortOrder = "title"
+)
+
+// ListOptions selects a page of posts
+type ListOptions struct {
+	// First is the page size up to MaxPageSize, zero lists every post after the cursor
+	First int
+	// After is the cursor of the post preceding the page
+	After string
+	Sort  SortOrder
+	// Since and Until limit the publishing date, Since inclusive and Until exclusive
+	Since    time.Time
+	Until    time.Time
+	Tag      string
+	Category string
+}
+
+// MaxPageSize is the most posts a page may hold
+const MaxPageSize = 100
+
+// DefaultPageSize is the page size of the APIs when none is asked for
+const DefaultPageSize = 20
+
+// cursorTimeLayout writes dates of sort keys with a fixed width, so that they compare like the dates
+const cursorTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// ErrInvalidListOptions is wrapped by errors from bad cursors, sort orders or page sizes
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// BlogPostsPage is a page of posts with a cursor for each post
+type BlogPostsPage struct {
+	Posts       []BlogPostMeta
+	Cursors     []string
+	HasNextPage bool
+	TotalCount  int
+}
+
+// EndCursor is the cursor to continue listing after this page
+func (p BlogPostsPage) EndCursor() string {
+	if len(p.Cursors) == 0 {
+		return ""
+	}
+	return p.Cursors[len(p.Cursors)-1]
+}
+
+func (o SortOrder) valid() bool {
+	return o == SortPublished || o == SortUpdated || o == SortTitle
+}
+
+// ParseSortOrder reads a sort order, defaulting to SortPublished
+func ParseSortOrder(s string) (SortOrder, error) {
+	if s == "" {
+		return SortPublished, nil
+	}
+	o := SortOrder(strings.ToLower(s))
+	if !o.valid() {
+		return "", fmt.Errorf("%w: unknown sort order %q", ErrInvalidListOptions, s)
+	}
+	return o, nil
+}
+
+func (o SortOrder) key(meta BlogPostMeta) string {
+	switch o {
+	case SortUpdated:
+		return meta.Updated.UTC().Format(cursorTimeLayout)
+	case SortTitle:
+		return strings.ToLower(meta.Title)
+	default:
+		return meta.Published.UTC().Format(cursorTimeLayout)
+	}
+}
+
+// compare orders posts by the sort key, ties broken by ID
+func (o SortOrder) compare(aKey, aID, bKey, bID string) int {
+	c := strings.Compare(aKey, bKey)
+	if o != SortTitle {
+		// Dates are listed newest first
+		c = -c
+	}
+	if c == 0 {
+		c = strings.Compare(aID, bID)
+	}
+	return c
+}
+
+// Cursor is the opaque position of a post in a listing
+func Cursor(meta BlogPostMeta, sort SortOrder) string {
+	return encodeCursor(sort.key(meta), meta.ID)
+}
+
+func encodeCursor(key, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key + "\x00" + id))
+}
+
+func parseCursor(cursor string) (key, id string, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: cursor: %w", ErrInvalidListOptions, err)
+	}
+	key, id, ok := strings.Cut(string(b), "\x00")
+	if !ok {
+		return "", "", fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	return key, id, nil
+}
+
+// PageOf selects a page from metadata of every post, for stores that have to list everything anyway
+func PageOf(metas []BlogPostMeta, opts ListOptions) (BlogPostsPage, error) {
+
+	listing, err := NewListing(metas, opts.Sort)
+	if err != nil {
+		return BlogPostsPage{}, err
+	}
+	return listing.Page(opts)
+}
+
+// Listing is the metadata of posts sorted in one order. Caches keep it to serve pages
+// by seeking to the cursor, without sorting every post again.
+type Listing struct {
+	sort  SortOrder
+	posts []listed
+}
+
+// listed is a post with its sort key
+type listed struct {
+	key  string
+	meta BlogPostMeta
+}
+
+// NewListing sorts a copy of the metadata, by SortPublished when sort is empty
+func NewListing(metas []BlogPostMeta, sort SortOrder) (*Listing, error) {
+
+	if sort == "" {
+		sort = SortPublished
+	}
+	if !sort.valid() {
+		return nil, fmt.Errorf("%w: unknown sort order %q", ErrInvalidListOptions, sort)
+	}
+	posts := make([]listed, 0, len(metas))
+	for _, meta := range metas {
+		posts = append(posts, listed{sort.key(meta), meta})
+	}
+	slices.SortFunc(posts, func(a, b listed) int {
+		return sort.compare(a.key, a.meta.ID, b.key, b.meta.ID)
+	})
+	return &Listing{sort: sort, posts: posts}, nil
+}
+
+// Page selects a page of the listing, the sort order of the options is the one of the listing
+func (l *Listing) Page(opts ListOptions) (BlogPostsPage, error) {
+
+	if opts.First < 0 || opts.First > MaxPageSize {
+		return BlogPostsPage{}, fmt.Errorf("%w: page size must be between 0 and %d", ErrInvalidListOptions, MaxPageSize)
+	}
+
+	filtered := len(opts.Tag) > 0 || len(opts.Category) > 0 || !opts.Since.IsZero() || !opts.Until.IsZero()
+	matches := func(meta BlogPostMeta) bool {
+		return (len(opts.Tag) == 0 || containsFold(meta.Tags, opts.Tag)) &&
+			(len(opts.Category) == 0 || containsFold(meta.Categories, opts.Category)) &&
+			(opts.Since.IsZero() || !meta.Published.Before(opts.Since)) &&
+			(opts.Until.IsZero() || meta.Published.Before(opts.Until))
+	}
+
+	page := BlogPostsPage{TotalCount: len(l.posts)}
+	if filtered {
+		page.TotalCount = 0
+		for _, p := range l.posts {
+			if matches(p.meta) {
+				page.TotalCount++
+			}
+		}
+	}
+
+	start := 0
+	if len(opts.After) > 0 {
+		key, id, err := parseCursor(opts.After)
+		if err != nil {
+			return BlogPostsPage{}, err
+		}
+		// The post of the cursor may be gone, the page starts after where it was sorted
+		var found bool
+		start, found = slices.BinarySearchFunc(l.posts, listed{key, BlogPostMeta{ID: id}}, func(p, cursor listed) int {
+			return l.sort.compare(p.key, p.meta.ID, cursor.key, cursor.meta.ID)
+		})
+		if found {
+			start++
+		}
+	}
+
+	page.Posts = make([]BlogPostMeta, 0)
+	page.Cursors = make([]string, 0)
+	for _, p := range l.posts[start:] {
+		if !matches(p.meta) {
+			continue
+		}
+		if opts.First > 0 && len(page.Posts) == opts.First {
+			page.HasNextPage = true
+			break
+		}
+		page.Posts = append(page.Posts, p.meta)
+		page.Cursors = append(page.Cursors, encodeCursor(p.key, p.meta.ID))
+	}
+	return page, nil
+}
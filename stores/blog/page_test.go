@@ -0,0 +1,112 @@
+package blog
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func day(d int) time.Time {
+	return time.Date(2021, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+var pageMetas = []BlogPostMeta{
+	{ID: "a", Title: "Charlie", Published: day(1), Updated: day(9), Tags: []string{"go"}},
+	{ID: "b", Title: "alpha", Published: day(3), Updated: day(4)},
+	{ID: "c", Title: "Bravo", Published: day(2), Updated: day(8), Tags: []string{"go"}},
+	{ID: "d", Title: "Delta", Published: day(3), Updated: day(3)},
+}
+
+func pageIDs(p BlogPostsPage) []string {
+	ids := make([]string, 0, len(p.Posts))
+	for _, meta := range p.Posts {
+		ids = append(ids, meta.ID)
+	}
+	return ids
+}
+
+func TestPageOf(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		opts     ListOptions
+		want     []string
+		wantNext bool
+		total    int
+	}{
+		{"Published by default", ListOptions{}, []string{"b", "d", "c", "a"}, false, 4},
+		{"Updated", ListOptions{Sort: SortUpdated}, []string{"a", "c", "b", "d"}, false, 4},
+		{"Title", ListOptions{Sort: SortTitle}, []string{"b", "c", "a", "d"}, false, 4},
+		{"First page", ListOptions{First: 2}, []string{"b", "d"}, true, 4},
+		{"Next page", ListOptions{First: 2, After: Cursor(pageMetas[3], SortPublished)}, []string{"c", "a"}, false, 4},
+		{"After last", ListOptions{After: Cursor(pageMetas[0], SortPublished)}, []string{}, false, 4},
+		{"Since", ListOptions{Since: day(2)}, []string{"b", "d", "c"}, false, 3},
+		{"Until", ListOptions{Until: day(3)}, []string{"c", "a"}, false, 2},
+		{"Tag", ListOptions{Tag: "Go", Sort: SortTitle}, []string{"c", "a"}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PageOf(pageMetas, tt.opts)
+			if err != nil {
+				t.Fatalf("PageOf() error = %v", err)
+			}
+			assert.Equal(t, tt.want, pageIDs(got))
+			assert.Equal(t, tt.wantNext, got.HasNextPage)
+			assert.Equal(t, tt.total, got.TotalCount)
+			assert.Len(t, got.Cursors, len(got.Posts))
+		})
+	}
+}
+
+func TestPageOfCursorSurvivesDeletion(t *testing.T) {
+
+	first, err := PageOf(pageMetas, ListOptions{First: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := []BlogPostMeta{pageMetas[0], pageMetas[1], pageMetas[2]}
+	next, err := PageOf(remaining, ListOptions{First: 2, After: first.EndCursor()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"c", "a"}, pageIDs(next))
+}
+
+func TestPageOfInvalidOptions(t *testing.T) {
+
+	for _, opts := range []ListOptions{
+		{After: "not a cursor!"},
+		{After: "bm8tc2VwYXJhdG9y"},
+		{Sort: "random"},
+		{First: -1},
+		{First: MaxPageSize + 1},
+	} {
+		_, err := PageOf(pageMetas, opts)
+		if !errors.Is(err, ErrInvalidListOptions) {
+			t.Errorf("PageOf(%+v) error = %v, want ErrInvalidListOptions", opts, err)
+		}
+	}
+}
+
+func TestPageOfFractionalSeconds(t *testing.T) {
+
+	noon := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	metas := []BlogPostMeta{
+		{ID: "a", Published: noon},
+		{ID: "b", Published: noon.Add(500 * time.Millisecond)},
+		{ID: "c", Published: noon.Add(550 * time.Millisecond)},
+	}
+	page, err := PageOf(metas, ListOptions{First: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"c"}, pageIDs(page))
+
+	page, err = PageOf(metas, ListOptions{After: page.EndCursor()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"b", "a"}, pageIDs(page))
+}
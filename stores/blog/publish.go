@@ -0,0 +1,217 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// ErrPostNotFound is returned for posts that are not published
+var ErrPostNotFound = errors.New("post not found")
+
+// IsPublishedAt reports if the post is visible at t, it is not a draft and
+// its date is not after t. Posts without a date are published.
+func (m BlogPostMeta) IsPublishedAt(t time.Time) bool {
+	return !m.Draft && !m.Published.After(t)
+}
+
+// PublishedBlogStore hides drafts and posts scheduled for later from the blog store it wraps
+type PublishedBlogStore struct {
+	store BlogStore
+	now   func() time.Time
+}
+
+func NewPublishedBlogStore(store BlogStore) *PublishedBlogStore {
+	return &PublishedBlogStore{store: store, now: time.Now}
+}
+
+// GetBlogPostsMeta lists the published posts
+func (pbs *PublishedBlogStore) GetBlogPostsMeta(ctx context.Context) ([]BlogPostMeta, error) {
+
+	metas, err := pbs.store.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := pbs.now()
+	published := make([]BlogPostMeta, 0, len(metas))
+	for _, m := range metas {
+		if m.IsPublishedAt(now) {
+			published = append(published, m)
+		}
+	}
+	return published, nil
+}
+
+// GetBlogPostsPage lists a page of the published posts
+func (pbs *PublishedBlogStore) GetBlogPostsPage(ctx context.Context, opts ListOptions) (BlogPostsPage, error) {
+	metas, err := pbs.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return BlogPostsPage{}, err
+	}
+	return PageOf(metas, opts)
+}
+
+// GetBlogPost gets a published post, drafts and scheduled posts are not found
+func (pbs *PublishedBlogStore) GetBlogPost(ctx context.Context, id string) (BlogPost, error) {
+
+	post, err := pbs.store.GetBlogPost(ctx, id)
+	if err != nil {
+		return BlogPost{}, err
+	}
+	if !post.Meta.IsPublishedAt(pbs.now()) {
+		return BlogPost{}, ErrPostNotFound
+	}
+	return post, nil
+}
+
+// scheduleRetryDelay is how long to wait before listing the scheduled posts again after listing failed
+const scheduleRetryDelay = time.Minute
+
+// PublishScheduler passes on the updates of a blog store, and sends the IDs of
+// scheduled posts on UpdatesChan when they are published, so caches of the
+// published posts are invalidated
+type PublishScheduler struct {
+	store   BlogStore
+	updates <-chan string
+	now     func() time.Time
+	// scheduled is when the posts scheduled for later are published, it is only used by run
+	scheduled   map[string]time.Time
+	UpdatesChan chan string
+}
+
+// NewPublishScheduler schedules the posts of the store, which must list drafts and scheduled posts.
+// The store is listed once, after that only the updated posts are looked up.
+// It stops when the updates channel is closed or the context is done.
+func NewPublishScheduler(ctx context.Context, store BlogStore, updates <-chan string) *PublishScheduler {
+
+	ps := &PublishScheduler{
+		store:       store,
+		updates:     updates,
+		now:         time.Now,
+		scheduled:   make(map[string]time.Time),
+		UpdatesChan: make(chan string),
+	}
+	go ps.run(ctx)
+	return ps
+}
+
+func (ps *PublishScheduler) run(ctx context.Context) {
+	defer close(ps.UpdatesChan)
+
+	listed := false
+	for {
+		if !listed {
+			err := ps.list(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "listing scheduled posts", slog.Any("err", err))
+			}
+			listed = err == nil
+		}
+		delay, ids := ps.next()
+		if !listed {
+			delay, ids = scheduleRetryDelay, nil
+		}
+		var timer *time.Timer
+		var publish <-chan time.Time
+		if delay >= 0 {
+			timer = time.NewTimer(delay)
+			publish = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case id, ok := <-ps.updates:
+			if timer != nil {
+				timer.Stop()
+			}
+			if !ok {
+				return
+			}
+			// The post may have been scheduled or rescheduled, so it is looked up again
+			if listed {
+				ps.lookup(ctx, id)
+			}
+			if !ps.send(ctx, id) {
+				return
+			}
+		case <-publish:
+			for _, id := range ids {
+				delete(ps.scheduled, id)
+				if !ps.send(ctx, id) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// send passes on the ID, it reports false when the context is done first
+func (ps *PublishScheduler) send(ctx context.Context, id string) bool {
+	select {
+	case ps.UpdatesChan <- id:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// list finds the scheduled posts of the store
+func (ps *PublishScheduler) list(ctx context.Context) error {
+
+	metas, err := ps.store.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return err
+	}
+	clear(ps.scheduled)
+	for _, m := range metas {
+		ps.schedule(m)
+	}
+	return nil
+}
+
+// lookup schedules an updated post again, removed posts are no longer scheduled
+func (ps *PublishScheduler) lookup(ctx context.Context, id string) {
+
+	delete(ps.scheduled, id)
+	post, err := ps.store.GetBlogPost(ctx, id)
+	if errors.Is(err, ErrPostNotFound) {
+		return
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "looking up updated post", slog.String("id", id), slog.Any("err", err))
+		return
+	}
+	ps.schedule(post.Meta)
+}
+
+func (ps *PublishScheduler) schedule(m BlogPostMeta) {
+	if !m.Draft && m.Published.After(ps.now()) {
+		ps.scheduled[m.ID] = m.Published
+	}
+}
+
+// next finds the posts that are published next and how long until then, the delay is negative when none are scheduled
+func (ps *PublishScheduler) next() (time.Duration, []string) {
+
+	var next time.Time
+	var ids []string
+	for id, published := range ps.scheduled {
+		switch {
+		case next.IsZero() || published.Before(next):
+			next, ids = published, []string{id}
+		case published.Equal(next):
+			ids = append(ids, id)
+		}
+	}
+	if next.IsZero() {
+		return -1, nil
+	}
+	slices.Sort(ids)
+	return max(0, next.Sub(ps.now())), ids
+}
@@ -0,0 +1,148 @@
+package blog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStore keeps posts in memory, it is safe to change while in use
+type fakeStore struct {
+	mu       sync.Mutex
+	posts    map[string]BlogPostMeta
+	listings int
+}
+
+func (fs *fakeStore) set(m BlogPostMeta) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.posts[m.ID] = m
+}
+
+func (fs *fakeStore) GetBlogPostsMeta(ctx context.Context) ([]BlogPostMeta, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.listings++
+	metas := make([]BlogPostMeta, 0, len(fs.posts))
+	for _, m := range fs.posts {
+		metas = append(metas, m)
+	}
+	return metas, nil
+}
+
+func (fs *fakeStore) GetBlogPostsPage(ctx context.Context, opts ListOptions) (BlogPostsPage, error) {
+	metas, _ := fs.GetBlogPostsMeta(ctx)
+	return PageOf(metas, opts)
+}
+
+func (fs *fakeStore) GetBlogPost(ctx context.Context, id string) (BlogPost, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	m, ok := fs.posts[id]
+	if !ok {
+		return BlogPost{}, fmt.Errorf("no post %s", id)
+	}
+	return BlogPost{Meta: m, Content: "Content of " + id}, nil
+}
+
+func TestPublishedBlogStore(t *testing.T) {
+
+	store := &fakeStore{posts: map[string]BlogPostMeta{
+		"old":       {ID: "old", Published: day(1)},
+		"undated":   {ID: "undated"},
+		"draft":     {ID: "draft", Published: day(1), Draft: true},
+		"scheduled": {ID: "scheduled", Published: day(20)},
+	}}
+	pbs := NewPublishedBlogStore(store)
+	pbs.now = func() time.Time { return day(10) }
+	ctx := context.Background()
+
+	metas, err := pbs.GetBlogPostsMeta(ctx)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, m := range metas {
+		ids = append(ids, m.ID)
+	}
+	assert.ElementsMatch(t, []string{"old", "undated"}, ids)
+
+	page, err := pbs.GetBlogPostsPage(ctx, ListOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old", "undated"}, pageIDs(page))
+
+	_, err = pbs.GetBlogPost(ctx, "old")
+	assert.NoError(t, err)
+	for _, id := range []string{"draft", "scheduled"} {
+		_, err = pbs.GetBlogPost(ctx, id)
+		assert.ErrorIs(t, err, ErrPostNotFound, id)
+	}
+
+	// Scheduled posts are published at their date
+	pbs.now = func() time.Time { return day(20) }
+	_, err = pbs.GetBlogPost(ctx, "scheduled")
+	assert.NoError(t, err)
+}
+
+func TestPublishScheduler(t *testing.T) {
+
+	now := time.Now()
+	store := &fakeStore{posts: map[string]BlogPostMeta{
+		"old":   {ID: "old", Published: now.Add(-time.Hour)},
+		"draft": {ID: "draft", Published: now.Add(50 * time.Millisecond), Draft: true},
+		"soon":  {ID: "soon", Published: now.Add(100 * time.Millisecond)},
+	}}
+	updates := make(chan string)
+	ps := NewPublishScheduler(context.Background(), store, updates)
+
+	next := func() string {
+		select {
+		case id := <-ps.UpdatesChan:
+			return id
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an update")
+			return ""
+		}
+	}
+
+	// Updates of the store are passed on, and a post scheduled by one is published too
+	store.set(BlogPostMeta{ID: "later", Published: now.Add(200 * time.Millisecond)})
+	updates <- "later"
+	assert.Equal(t, "later", next())
+
+	assert.Equal(t, "soon", next())
+	assert.False(t, time.Now().Before(now.Add(100*time.Millisecond)), "published too early")
+	assert.Equal(t, "later", next())
+
+	// A post that is no longer scheduled is not published
+	store.set(BlogPostMeta{ID: "unscheduled", Published: now.Add(time.Hour)})
+	updates <- "unscheduled"
+	assert.Equal(t, "unscheduled", next())
+	store.set(BlogPostMeta{ID: "unscheduled", Published: now.Add(time.Hour), Draft: true})
+	updates <- "unscheduled"
+	assert.Equal(t, "unscheduled", next())
+	assert.Empty(t, ps.scheduled)
+
+	store.mu.Lock()
+	assert.Equal(t, 1, store.listings, "updated posts are looked up without listing the store")
+	store.mu.Unlock()
+
+	close(updates)
+	_, ok := <-ps.UpdatesChan
+	assert.False(t, ok, "updates are closed with the store updates")
+}
+
+func TestPublishScheduler_Cancel(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ps := NewPublishScheduler(ctx, &fakeStore{posts: map[string]BlogPostMeta{}}, make(chan string))
+	cancel()
+	select {
+	case _, ok := <-ps.UpdatesChan:
+		assert.False(t, ok, "updates are closed when the context is done")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the scheduler to stop")
+	}
+}
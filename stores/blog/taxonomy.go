@@ -0,0 +1,67 @@
+package blog
+
+import (
+	"slices"
+	"strings"
+)
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// CountTags lists the tags used by the posts with the number of posts using them
+func CountTags(metas []BlogPostMeta) []TagCount {
+
+	counts := make(map[string]*TagCount)
+	for _, meta := range metas {
+		for _, tag := range meta.Tags {
+			key := strings.ToLower(tag)
+			tc, ok := counts[key]
+			if !ok {
+				tc = &TagCount{Tag: tag}
+				counts[key] = tc
+			}
+			tc.Count++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for _, tc := range counts {
+		tags = append(tags, *tc)
+	}
+	slices.SortFunc(tags, func(a, b TagCount) int {
+		return strings.Compare(strings.ToLower(a.Tag), strings.ToLower(b.Tag))
+	})
+	return tags
+}
+
+// FilterByTag keeps the posts tagged with tag, ignoring case
+func FilterByTag(metas []BlogPostMeta, tag string) []BlogPostMeta {
+	return filter(metas, func(meta BlogPostMeta) bool {
+		return containsFold(meta.Tags, tag)
+	})
+}
+
+// FilterByCategory keeps the posts in category, ignoring case
+func FilterByCategory(metas []BlogPostMeta, category string) []BlogPostMeta {
+	return filter(metas, func(meta BlogPostMeta) bool {
+		return containsFold(meta.Categories, category)
+	})
+}
+
+func filter(metas []BlogPostMeta, keep func(BlogPostMeta) bool) []BlogPostMeta {
+	filtered := make([]BlogPostMeta, 0)
+	for _, meta := range metas {
+		if keep(meta) {
+			filtered = append(filtered, meta)
+		}
+	}
+	return filtered
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool {
+		return strings.EqualFold(v, s)
+	})
+}
@@ -0,0 +1,27 @@
+package blog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var taxonomyMetas = []BlogPostMeta{
+	{ID: "foo", Tags: []string{"Go", "web"}, Categories: []string{"Programming"}},
+	{ID: "bar", Tags: []string{"go"}},
+	{ID: "baz", Categories: []string{"programming", "life"}},
+}
+
+func TestCountTags(t *testing.T) {
+	assert.Equal(t, []TagCount{{"Go", 2}, {"web", 1}}, CountTags(taxonomyMetas))
+	assert.Equal(t, []TagCount{}, CountTags(nil))
+}
+
+func TestFilterByTag(t *testing.T) {
+	assert.Equal(t, taxonomyMetas[:2], FilterByTag(taxonomyMetas, "GO"))
+	assert.Equal(t, []BlogPostMeta{}, FilterByTag(taxonomyMetas, "rust"))
+}
+
+func TestFilterByCategory(t *testing.T) {
+	assert.Equal(t, []BlogPostMeta{taxonomyMetas[0], taxonomyMetas[2]}, FilterByCategory(taxonomyMetas, "programming"))
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/zaker/anachrome-be/stores/blog"
 )
@@ -11,4 +12,22 @@ type CacheError error
 type CachedBlogStore interface {
 	blog.BlogStore
 	Invalidate(context.Context, string) error
+	// Entries lists what is cached, ordered by key
+	Entries(context.Context) ([]Entry, error)
+	// Flush removes everything from the cache
+	Flush(context.Context) error
+}
+
+// Entry is an item in the cache
+type Entry struct {
+	Key string `json:"key"`
+	// Size is the number of bytes cached
+	Size   int       `json:"size"`
+	Stored time.Time `json:"stored"`
+}
+
+// BlobCache keeps derived content, like resized images, that is expensive to compute
+type BlobCache interface {
+	GetBlob(ctx context.Context, key string) ([]byte, bool)
+	SetBlob(ctx context.Context, key string, b []byte) error
 }
@@ -5,6 +5,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"encoding/gob"
@@ -16,20 +19,58 @@ import (
 type InMemoryCache struct {
 	persist blog.BlogStore
 
-	cache *cache.TinyLFU
+	cache    *cache.TinyLFU
+	blobs    *cache.TinyLFU
+	listings *listings
+
+	// stored tracks the keys set in the caches, which may have evicted them since
+	mu     sync.Mutex
+	stored map[string]Entry
 }
 
 func NewInMemoryCache(p blog.BlogStore) (*InMemoryCache, error) {
 
-	return &InMemoryCache{persist: p, cache: cache.NewTinyLFU(1000, time.Minute)}, nil
+	return &InMemoryCache{
+		persist:  p,
+		cache:    cache.NewTinyLFU(1000, time.Minute),
+		blobs:    cache.NewTinyLFU(100, time.Hour),
+		listings: &listings{load: p.GetBlogPostsMeta},
+		stored:   make(map[string]Entry),
+	}, nil
+}
+
+// lfu is the cache holding the key, blobs are kept apart from posts
+func (imbc *InMemoryCache) lfu(key string) *cache.TinyLFU {
+	if strings.HasPrefix(key, "blob:") {
+		return imbc.blobs
+	}
+	return imbc.cache
+}
+
+func (imbc *InMemoryCache) set(key string, b []byte) {
+	imbc.mu.Lock()
+	defer imbc.mu.Unlock()
+	imbc.lfu(key).Set(key, b)
+	imbc.stored[key] = Entry{Key: key, Size: len(b), Stored: time.Now()}
+}
+
+func (imbc *InMemoryCache) del(key string) {
+	imbc.mu.Lock()
+	defer imbc.mu.Unlock()
+	imbc.lfu(key).Del(key)
+	delete(imbc.stored, key)
 }
 
 func (imbc *InMemoryCache) GetBlogPost(ctx context.Context, id string) (blog.BlogPost, error) {
 
+	ctx, span := tracer.Start(ctx, "InMemoryCache.GetBlogPost")
+	defer span.End()
 	b := bytes.Buffer{}
 	gob.Register(blog.BlogPost{})
 
-	m, ok := imbc.cache.Get(id)
+	key := "post:" + id
+	m, ok := imbc.cache.Get(key)
+	observeLookup(ctx, memoryCache, "post", ok)
 	if ok {
 		dec := gob.NewDecoder(&b)
 		bp := blog.BlogPost{}
@@ -57,15 +98,83 @@ func (imbc *InMemoryCache) GetBlogPost(ctx context.Context, id string) (blog.Blo
 		return blog.BlogPost{}, err
 	}
 
-	imbc.cache.Set(id, m)
+	imbc.set(key, m)
 	return bp, nil
 }
 
+// GetBlogPostsMeta lists the posts from the cached metadata, until a post changes
 func (imbc *InMemoryCache) GetBlogPostsMeta(ctx context.Context) ([]blog.BlogPostMeta, error) {
-	return imbc.persist.GetBlogPostsMeta(ctx)
+
+	ctx, span := tracer.Start(ctx, "InMemoryCache.GetBlogPostsMeta")
+	defer span.End()
+	return imbc.listings.meta(ctx)
+}
+
+// GetBlogPostsPage serves a page from the cached metadata, kept sorted in the orders asked for
+func (imbc *InMemoryCache) GetBlogPostsPage(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+
+	ctx, span := tracer.Start(ctx, "InMemoryCache.GetBlogPostsPage")
+	defer span.End()
+	return imbc.listings.page(ctx, opts)
 }
 
 func (imbc *InMemoryCache) Invalidate(ctx context.Context, id string) error {
-	imbc.cache.Del(id)
+
+	_, span := tracer.Start(ctx, "InMemoryCache.Invalidate")
+	defer span.End()
+	imbc.del("post:" + id)
+	imbc.listings.reset()
+	cacheInvalidations.WithLabelValues(memoryCache).Inc()
+	return nil
+}
+
+func (imbc *InMemoryCache) GetBlob(ctx context.Context, key string) ([]byte, bool) {
+
+	ctx, span := tracer.Start(ctx, "InMemoryCache.GetBlob")
+	defer span.End()
+	b, ok := imbc.blobs.Get("blob:" + key)
+	observeLookup(ctx, memoryCache, "blob", ok)
+	return b, ok
+}
+
+func (imbc *InMemoryCache) SetBlob(ctx context.Context, key string, b []byte) error {
+
+	_, span := tracer.Start(ctx, "InMemoryCache.SetBlob")
+	defer span.End()
+	imbc.set("blob:"+key, b)
+	return nil
+}
+
+// Entries lists the posts and blobs still in the cache
+func (imbc *InMemoryCache) Entries(ctx context.Context) ([]Entry, error) {
+
+	imbc.mu.Lock()
+	defer imbc.mu.Unlock()
+	entries := make([]Entry, 0, len(imbc.stored))
+	for key, ent := range imbc.stored {
+		if _, ok := imbc.lfu(key).Get(key); !ok {
+			// Evicted or expired
+			delete(imbc.stored, key)
+			continue
+		}
+		entries = append(entries, ent)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Flush removes every post and blob from the cache
+func (imbc *InMemoryCache) Flush(ctx context.Context) error {
+
+	_, span := tracer.Start(ctx, "InMemoryCache.Flush")
+	defer span.End()
+	cacheFlushes.WithLabelValues(memoryCache).Inc()
+	imbc.listings.reset()
+	imbc.mu.Lock()
+	defer imbc.mu.Unlock()
+	for key := range imbc.stored {
+		imbc.lfu(key).Del(key)
+	}
+	clear(imbc.stored)
 	return nil
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/zaker/anachrome-be/mocks"
 
@@ -69,3 +72,115 @@ func TestCache(t *testing.T) {
 	assert.Equal(t, 3, callsToGBP)
 
 }
+
+func TestCache_Entries(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id}, Content: "Content of " + id}, nil
+		},
+	}
+	c, err := NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatalf("Initializing cache failed: %v", err)
+	}
+	ctx := context.Background()
+
+	entries, err := c.Entries(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = c.GetBlogPost(ctx, "foo")
+	assert.NoError(t, err)
+	_, err = c.GetBlogPost(ctx, "bar")
+	assert.NoError(t, err)
+	assert.NoError(t, c.SetBlob(ctx, "image:1", []byte("PNG")))
+
+	entries, err = c.Entries(ctx)
+	assert.NoError(t, err)
+	keys := []string{}
+	for _, ent := range entries {
+		keys = append(keys, ent.Key)
+		assert.Positive(t, ent.Size, ent.Key)
+		assert.WithinDuration(t, time.Now(), ent.Stored, time.Minute, ent.Key)
+	}
+	assert.Equal(t, []string{"blob:image:1", "post:bar", "post:foo"}, keys)
+	assert.Equal(t, 3, entries[0].Size)
+
+	assert.NoError(t, c.Invalidate(ctx, "bar"))
+	entries, _ = c.Entries(ctx)
+	assert.Len(t, entries, 2)
+
+	assert.NoError(t, c.Flush(ctx))
+	entries, _ = c.Entries(ctx)
+	assert.Empty(t, entries)
+	_, ok := c.GetBlob(ctx, "image:1")
+	assert.False(t, ok)
+	_, err = c.GetBlogPost(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Len(t, mbs.GetBlogPostCalls(), 3, "flushed posts are read again")
+}
+
+func TestCache_Metrics(t *testing.T) {
+
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			return blog.BlogPost{Meta: blog.BlogPostMeta{ID: id}}, nil
+		},
+	}
+	c, err := NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatalf("Initializing cache failed: %v", err)
+	}
+	ctx := context.Background()
+	count := func(cv *prometheus.CounterVec, labels ...string) float64 {
+		return testutil.ToFloat64(cv.WithLabelValues(labels...))
+	}
+	hits, misses := count(cacheLookups, memoryCache, "post", "hit"), count(cacheLookups, memoryCache, "post", "miss")
+	invalidations := count(cacheInvalidations, memoryCache)
+
+	for range 3 {
+		_, err = c.GetBlogPost(ctx, "foo")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.Invalidate(ctx, "foo"))
+
+	assert.Equal(t, 2.0, count(cacheLookups, memoryCache, "post", "hit")-hits)
+	assert.Equal(t, 1.0, count(cacheLookups, memoryCache, "post", "miss")-misses)
+	assert.Equal(t, 1.0, count(cacheInvalidations, memoryCache)-invalidations)
+}
+
+func TestCache_Pages(t *testing.T) {
+
+	metas := []blog.BlogPostMeta{
+		{ID: "old", Published: time.Date(2021, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{ID: "new", Published: time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC)},
+	}
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsMetaFunc: func(ctx context.Context) ([]blog.BlogPostMeta, error) {
+			return metas, nil
+		},
+	}
+	c, err := NewInMemoryCache(mbs)
+	if err != nil {
+		t.Fatalf("Initializing cache failed: %v", err)
+	}
+	ctx := context.Background()
+
+	first, err := c.GetBlogPostsPage(ctx, blog.ListOptions{First: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "new", first.Posts[0].ID)
+	next, err := c.GetBlogPostsPage(ctx, blog.ListOptions{First: 1, After: first.EndCursor()})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", next.Posts[0].ID)
+	_, err = c.GetBlogPostsPage(ctx, blog.ListOptions{Sort: blog.SortTitle})
+	assert.NoError(t, err)
+	assert.Len(t, mbs.GetBlogPostsMetaCalls(), 1, "pages are served from the cached listing")
+
+	metas = append(metas, blog.BlogPostMeta{ID: "newest", Published: time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, c.Invalidate(ctx, "newest"))
+	first, err = c.GetBlogPostsPage(ctx, blog.ListOptions{First: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "newest", first.Posts[0].ID)
+	assert.Len(t, mbs.GetBlogPostsMetaCalls(), 2, "changed posts are listed again")
+}
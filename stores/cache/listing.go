@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+// listings keeps the metadata of the posts sorted in the orders pages were asked for.
+// It is loaded again after a reset, or when it is older than ttl unless ttl is zero.
+type listings struct {
+	load func(context.Context) ([]blog.BlogPostMeta, error)
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	loaded time.Time
+	metas  []blog.BlogPostMeta
+	sorted map[blog.SortOrder]*blog.Listing
+}
+
+// loadLocked loads the metadata unless it is loaded and fresh
+func (l *listings) loadLocked(ctx context.Context) error {
+
+	if l.sorted != nil && (l.ttl == 0 || time.Since(l.loaded) < l.ttl) {
+		return nil
+	}
+	metas, err := l.load(ctx)
+	if err != nil {
+		return err
+	}
+	l.metas, l.sorted, l.loaded = metas, make(map[blog.SortOrder]*blog.Listing), time.Now()
+	return nil
+}
+
+// meta returns a copy of the metadata of every post
+func (l *listings) meta(ctx context.Context) ([]blog.BlogPostMeta, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.loadLocked(ctx); err != nil {
+		return nil, err
+	}
+	return slices.Clone(l.metas), nil
+}
+
+// page serves a page from the listing in the sort order of the options, sorting it the first time
+func (l *listings) page(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.loadLocked(ctx); err != nil {
+		return blog.BlogPostsPage{}, err
+	}
+	sort := opts.Sort
+	if sort == "" {
+		sort = blog.SortPublished
+	}
+	listing, ok := l.sorted[sort]
+	if !ok {
+		var err error
+		listing, err = blog.NewListing(l.metas, sort)
+		if err != nil {
+			return blog.BlogPostsPage{}, err
+		}
+		l.sorted[sort] = listing
+	}
+	return listing.Page(opts)
+}
+
+// reset drops the metadata, it is loaded again for the next page
+func (l *listings) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.metas, l.sorted = nil, nil
+}
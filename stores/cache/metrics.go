@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/zaker/anachrome-be/stores/cache")
+
+var (
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anachrome_cache_lookups_total",
+		Help: "Cache lookups by cache, kind of item and result, hit or miss.",
+	}, []string{"cache", "kind", "result"})
+	cacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anachrome_cache_invalidations_total",
+		Help: "Posts invalidated by cache.",
+	}, []string{"cache"})
+	cacheFlushes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anachrome_cache_flushes_total",
+		Help: "Times the cache was flushed.",
+	}, []string{"cache"})
+)
+
+// Names of the caches in metrics
+const (
+	memoryCache = "memory"
+	redisCache  = "redis"
+)
+
+// observeLookup counts the lookup, marks the span in ctx as a hit or miss and logs it
+func observeLookup(ctx context.Context, cache, kind string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, kind, result).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", hit))
+	slog.DebugContext(ctx, "cache lookup", slog.String("cache", cache), slog.String("kind", kind), slog.String("result", result))
+}
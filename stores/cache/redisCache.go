@@ -4,17 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/cache/v8"
 	"github.com/go-redis/redis/v8"
-	"github.com/labstack/gommon/log"
 	"github.com/zaker/anachrome-be/stores/blog"
 )
 
+// blobTTL is how long derived content stays in redis after it was last computed
+const blobTTL = 7 * 24 * time.Hour
+
+// localTTL is how long redis items are kept in the local cache of each instance
+const localTTL = time.Minute
+
+// indexKey is a hash of the cached keys and when they were stored
+const indexKey = "CacheIndex"
+
 type RedisBlogCache struct {
-	persist blog.BlogStore
-	cache   *cache.Cache
+	persist  blog.BlogStore
+	cache    *cache.Cache
+	redis    *redis.Ring
+	listings *listings
 }
 
 func NewRedisBlogCache(p blog.BlogStore, redishost string) (*RedisBlogCache, error) {
@@ -26,30 +39,46 @@ func NewRedisBlogCache(p blog.BlogStore, redishost string) (*RedisBlogCache, err
 
 	cache := cache.New(&cache.Options{
 		Redis:      ring,
-		LocalCache: cache.NewTinyLFU(1000, time.Minute),
+		LocalCache: cache.NewTinyLFU(1000, localTTL),
 	})
 
-	return &RedisBlogCache{persist: p, cache: cache}, nil
+	rbc := &RedisBlogCache{persist: p, cache: cache, redis: ring}
+	// Other instances invalidate the metadata in redis, so the sorted listings expire like local items
+	rbc.listings = &listings{load: rbc.GetBlogPostsMeta, ttl: localTTL}
+	return rbc, nil
+}
+
+// set caches the item and adds its key to the index
+func (rbc *RedisBlogCache) set(item *cache.Item) error {
+	err := rbc.cache.Set(item)
+	if err != nil {
+		return err
+	}
+	return rbc.redis.HSet(item.Context(), indexKey, item.Key, time.Now().Unix()).Err()
 }
 
 func (rbc *RedisBlogCache) GetBlogPost(ctx context.Context, id string) (blog.BlogPost, error) {
 
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.GetBlogPost")
+	defer span.End()
 	var bp blog.BlogPost
 	key := "post:" + id
 	err := rbc.cache.Get(ctx, key, &bp)
 
 	if err == nil {
+		observeLookup(ctx, redisCache, "post", true)
 		return bp, nil
 	}
 	if err != nil && err != cache.ErrCacheMiss {
 		return bp, CacheError(errors.New("Failed to get post{" + key + "} "))
 	}
+	observeLookup(ctx, redisCache, "post", false)
 
 	bp, err = rbc.persist.GetBlogPost(ctx, id)
 	if err != nil {
 		return bp, err
 	}
-	err = rbc.cache.Set(
+	err = rbc.set(
 		&cache.Item{
 			Ctx:   ctx,
 			Key:   key,
@@ -64,21 +93,25 @@ func (rbc *RedisBlogCache) GetBlogPost(ctx context.Context, id string) (blog.Blo
 
 func (rbc *RedisBlogCache) GetBlogPostsMeta(ctx context.Context) ([]blog.BlogPostMeta, error) {
 
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.GetBlogPostsMeta")
+	defer span.End()
 	var bpm []blog.BlogPostMeta
 	err := rbc.cache.Get(ctx, "PostsMeta", &bpm)
 
 	if err == nil {
+		observeLookup(ctx, redisCache, "meta", true)
 		return bpm, nil
 	}
 	if err != nil && err != cache.ErrCacheMiss {
 		return nil, CacheError(fmt.Errorf("failed to get postmeta: %w", err))
 
 	}
+	observeLookup(ctx, redisCache, "meta", false)
 	bpm, err = rbc.persist.GetBlogPostsMeta(ctx)
 	if err != nil {
 		return nil, err
 	}
-	err = rbc.cache.Set(
+	err = rbc.set(
 		&cache.Item{
 			Ctx:   ctx,
 			Key:   "PostsMeta",
@@ -91,19 +124,139 @@ func (rbc *RedisBlogCache) GetBlogPostsMeta(ctx context.Context) ([]blog.BlogPos
 	return bpm, nil
 }
 
+// GetBlogPostsPage serves a page from the cached metadata, kept sorted in the orders asked for
+func (rbc *RedisBlogCache) GetBlogPostsPage(ctx context.Context, opts blog.ListOptions) (blog.BlogPostsPage, error) {
+
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.GetBlogPostsPage")
+	defer span.End()
+	return rbc.listings.page(ctx, opts)
+}
+
 func (rbc *RedisBlogCache) Invalidate(ctx context.Context, id string) error {
 
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.Invalidate")
+	defer span.End()
+	defer rbc.listings.reset()
 	key := "post:" + id
 	err := rbc.cache.Delete(ctx, key)
-	log.Print("Cache invalidates ", key)
+	slog.InfoContext(ctx, "cache invalidated", slog.String("key", key))
+	cacheInvalidations.WithLabelValues(redisCache).Inc()
 	if err != nil {
 		return CacheError(err)
 	}
 	err = rbc.cache.Delete(ctx, "PostsMeta")
 
+	if err != nil {
+		return CacheError(err)
+	}
+	err = rbc.redis.HDel(ctx, indexKey, key, "PostsMeta").Err()
 	if err != nil {
 		return CacheError(err)
 	}
 
 	return nil
 }
+
+func (rbc *RedisBlogCache) GetBlob(ctx context.Context, key string) ([]byte, bool) {
+
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.GetBlob")
+	defer span.End()
+	var b []byte
+	err := rbc.cache.Get(ctx, "blob:"+key, &b)
+	observeLookup(ctx, redisCache, "blob", err == nil)
+	if err != nil {
+		if err != cache.ErrCacheMiss {
+			slog.WarnContext(ctx, "getting blob from cache", slog.String("key", key), slog.Any("err", err))
+		}
+		return nil, false
+	}
+	return b, true
+}
+
+func (rbc *RedisBlogCache) SetBlob(ctx context.Context, key string, b []byte) error {
+
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.SetBlob")
+	defer span.End()
+	err := rbc.set(
+		&cache.Item{
+			Ctx:            ctx,
+			Key:            "blob:" + key,
+			Value:          b,
+			TTL:            blobTTL,
+			SkipLocalCache: true,
+		})
+	if err != nil {
+		return CacheError(fmt.Errorf("failed to set blob %s: %w", key, err))
+	}
+	return nil
+}
+
+// Ping reports if redis can be reached
+func (rbc *RedisBlogCache) Ping(ctx context.Context) error {
+	return rbc.redis.Ping(ctx).Err()
+}
+
+// Entries lists the indexed keys still in redis
+func (rbc *RedisBlogCache) Entries(ctx context.Context) ([]Entry, error) {
+
+	index, err := rbc.redis.HGetAll(ctx, indexKey).Result()
+	if err != nil {
+		return nil, CacheError(fmt.Errorf("failed to get cache index: %w", err))
+	}
+	keys := make([]string, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sizes := make([]*redis.IntCmd, len(keys))
+	_, err = rbc.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			sizes[i] = pipe.StrLen(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, CacheError(fmt.Errorf("failed to get cache sizes: %w", err))
+	}
+
+	entries := make([]Entry, 0, len(keys))
+	var expired []string
+	for i, key := range keys {
+		if sizes[i].Val() == 0 {
+			expired = append(expired, key)
+			continue
+		}
+		stored, _ := strconv.ParseInt(index[key], 10, 64)
+		entries = append(entries, Entry{Key: key, Size: int(sizes[i].Val()), Stored: time.Unix(stored, 0)})
+	}
+	if len(expired) > 0 {
+		rbc.redis.HDel(ctx, indexKey, expired...)
+	}
+	return entries, nil
+}
+
+// Flush removes every indexed key from redis and the local cache
+func (rbc *RedisBlogCache) Flush(ctx context.Context) error {
+
+	ctx, span := tracer.Start(ctx, "RedisBlogCache.Flush")
+	defer span.End()
+	defer rbc.listings.reset()
+	cacheFlushes.WithLabelValues(redisCache).Inc()
+	keys, err := rbc.redis.HKeys(ctx, indexKey).Result()
+	if err != nil {
+		return CacheError(fmt.Errorf("failed to get cache index: %w", err))
+	}
+	for _, key := range keys {
+		err = rbc.cache.Delete(ctx, key)
+		if err != nil {
+			return CacheError(err)
+		}
+	}
+	err = rbc.redis.Del(ctx, indexKey).Err()
+	if err != nil {
+		return CacheError(err)
+	}
+	slog.InfoContext(ctx, "cache flushed", slog.Int("keys", len(keys)))
+	return nil
+}
@@ -0,0 +1,145 @@
+package dropbox
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const authorizeURL = "https://www.dropbox.com/oauth2/authorize"
+
+// expiryMargin refreshes access tokens this long before Dropbox expires them
+const expiryMargin = time.Minute
+
+// tokenSource hands out short-lived access tokens, refreshing them once for all concurrent requests
+type tokenSource struct {
+	appKey       string
+	appSecret    string
+	refreshToken string
+	tokenURL     string
+	client       *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// token returns a valid access token, refreshing it when it expires or is the rejected token
+func (ts *tokenSource) token(ctx context.Context, rejected string) (string, error) {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if len(ts.accessToken) > 0 &&
+		ts.accessToken != rejected &&
+		time.Now().Add(expiryMargin).Before(ts.expiry) {
+		return ts.accessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {ts.refreshToken},
+		"client_id":     {ts.appKey},
+	}
+	// Refresh tokens from the PKCE flow are used without the app secret
+	if len(ts.appSecret) > 0 {
+		form.Set("client_secret", ts.appSecret)
+	}
+	res, err := requestToken(ctx, ts.client, ts.tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("refreshing access token: %w", err)
+	}
+	ts.accessToken = res.AccessToken
+	ts.expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	return ts.accessToken, nil
+}
+
+func requestToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (tr *tokenResponse, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting token: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		code, err := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("requesting token: %s , %w", code, err)
+	}
+
+	tr = &tokenResponse{}
+	err = json.NewDecoder(resp.Body).Decode(tr)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	return tr, nil
+}
+
+// NewPKCEVerifier creates a code verifier and its S256 challenge for the PKCE code flow
+func NewPKCEVerifier() (verifier, challenge string, err error) {
+
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("creating code verifier: %w", err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthorizeURL is where the user grants the app offline access, the page shows the code to exchange
+func AuthorizeURL(appKey, challenge string) string {
+
+	q := url.Values{
+		"client_id":             {appKey},
+		"response_type":         {"code"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+		"token_access_type":     {"offline"},
+	}
+	return authorizeURL + "?" + q.Encode()
+}
+
+// ExchangeCode trades the authorization code from the PKCE flow for a refresh token
+func (c *Client) ExchangeCode(ctx context.Context, appKey, code, verifier string) (string, error) {
+
+	res, err := requestToken(ctx, c.client, c.apiURL+"/oauth2/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {appKey},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return "", fmt.Errorf("exchanging code: %w", err)
+	}
+	if len(res.RefreshToken) == 0 {
+		return "", fmt.Errorf("exchanging code: no refresh token in response")
+	}
+	return res.RefreshToken, nil
+}
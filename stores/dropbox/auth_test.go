@@ -0,0 +1,144 @@
+package dropbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeTokenAPI hands out numbered access tokens for the refresh token and accepts only the latest
+func fakeTokenAPI(t *testing.T, expiresIn int) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var refreshes atomic.Int32
+	c, mux := fakeFolderAPI(t, FolderMetadata{Cursor: "c1"}, nil)
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" ||
+			r.FormValue("refresh_token") != "refresh" ||
+			r.FormValue("client_id") != "app" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		n := refreshes.Add(1)
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: fmt.Sprintf("token-%d", n), ExpiresIn: expiresIn})
+	})
+	c = NewClient(c.client, "", "", "metadata", WithAPIURL(c.apiURL), WithRefreshToken("app", "", "refresh"))
+	return c, &refreshes
+}
+
+func TestClient_RefreshToken(t *testing.T) {
+
+	c, refreshes := fakeTokenAPI(t, 14400)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			token, err := c.tokens.token(context.Background(), "")
+			if err != nil || token != "token-1" {
+				t.Errorf("token() = %s, %v, want token-1", token, err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("refreshed %d times for concurrent requests, want 1", n)
+	}
+
+	token, err := c.tokens.token(context.Background(), "token-1")
+	if err != nil || token != "token-2" {
+		t.Errorf("token() after rejection = %s, %v, want token-2", token, err)
+	}
+}
+
+func TestClient_RefreshTokenExpired(t *testing.T) {
+
+	// Tokens expiring within the margin are refreshed on every use
+	c, refreshes := fakeTokenAPI(t, 30)
+	for range 2 {
+		_, err := c.tokens.token(context.Background(), "")
+		if err != nil {
+			t.Fatalf("token() error = %v", err)
+		}
+	}
+	if n := refreshes.Load(); n != 2 {
+		t.Errorf("refreshed %d times, want 2", n)
+	}
+}
+
+func TestClient_RetryOnUnauthorized(t *testing.T) {
+
+	c, refreshes := fakeTokenAPI(t, 14400)
+	// The first token is revoked before it expires
+	c.client.Transport = rejectToken{"Bearer token-1", c.client.Transport}
+
+	fm, err := c.ListMainFolder(context.Background())
+	if err != nil {
+		t.Fatalf("Client.ListMainFolder() error = %v", err)
+	}
+	if fm.Cursor != "c1" {
+		t.Errorf("Client.ListMainFolder() cursor = %s, want c1", fm.Cursor)
+	}
+	if n := refreshes.Load(); n != 2 {
+		t.Errorf("refreshed %d times, want 2", n)
+	}
+}
+
+type rejectToken struct {
+	authorization string
+	next          http.RoundTripper
+}
+
+func (rt rejectToken) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") == rt.authorization {
+		return &http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	return rt.next.RoundTrip(req)
+}
+
+func TestPKCE(t *testing.T) {
+
+	verifier, challenge, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatalf("NewPKCEVerifier() error = %v", err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != want {
+		t.Errorf("challenge = %s, want %s", challenge, want)
+	}
+
+	u, err := url.Parse(AuthorizeURL("app", challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != "app" || q.Get("code_challenge") != challenge ||
+		q.Get("code_challenge_method") != "S256" || q.Get("token_access_type") != "offline" {
+		t.Errorf("AuthorizeURL() = %s", u)
+	}
+
+	c, mux := fakeFolderAPI(t, FolderMetadata{}, nil)
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "authorization_code" ||
+			r.FormValue("code") != "code" ||
+			r.FormValue("code_verifier") != verifier {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access", ExpiresIn: 14400, RefreshToken: "refresh"})
+	})
+	refreshToken, err := c.ExchangeCode(context.Background(), "app", "code", verifier)
+	if err != nil || refreshToken != "refresh" {
+		t.Errorf("Client.ExchangeCode() = %s, %v, want refresh", refreshToken, err)
+	}
+}
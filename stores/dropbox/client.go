@@ -1,15 +1,19 @@
 package dropbox
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 type FolderMetadata struct {
@@ -45,33 +49,173 @@ type EntryMetadata struct {
 	IsDownloadable bool             `json:"is_downloadable"`
 	PropertyGroups *[]propertyGroup `json:"property_groups,omitempty"`
 	ContentHash    string           `json:"content_hash"`
+	// Relisted marks entries sent again by a full sync
+	Relisted bool `json:"-"`
 }
 type AnachromeMeta struct {
-	Title     string
-	Published time.Time
-	Hash      string
+	Title      string
+	Published  time.Time
+	Hash       string
+	Tags       []string
+	Categories []string
+	Summary    string
+	Draft      bool
 }
 
+// maxPropertyValueBytes is the longest value Dropbox stores in a property field
+const maxPropertyValueBytes = 1024
+
+// fields lists the metadata as property template fields. Values longer than Dropbox
+// stores are cut, lists keep the items that fit.
+func (am AnachromeMeta) fields() []field {
+	return []field{
+		{Name: "title", Value: truncateValue(am.Title)},
+		{Name: "published", Value: am.Published.String()},
+		{Name: "hash", Value: am.Hash},
+		{Name: "tags", Value: encodeList(am.Tags)},
+		{Name: "categories", Value: encodeList(am.Categories)},
+		{Name: "summary", Value: truncateValue(am.Summary)},
+		{Name: "draft", Value: strconv.FormatBool(am.Draft)},
+	}
+}
+
+// truncateValue cuts the value to the property value limit on a rune boundary
+func truncateValue(value string) string {
+	if len(value) <= maxPropertyValueBytes {
+		return value
+	}
+	cut := maxPropertyValueBytes
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
+
+// encodeList writes the list as a JSON array, so that items may contain commas
+func encodeList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	for n := len(list); n > 0; n-- {
+		b, err := json.Marshal(list[:n])
+		if err == nil && len(b) <= maxPropertyValueBytes {
+			return string(b)
+		}
+	}
+	return ""
+}
+
+// decodeList reads a list written by encodeList, or comma separated by older versions
+func decodeList(value string) []string {
+	var list []string
+	if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &list) == nil {
+		return list
+	}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+const (
+	defaultAPIURL     = "https://api.dropboxapi.com"
+	defaultContentURL = "https://content.dropboxapi.com"
+	defaultNotifyURL  = "https://notify.dropboxapi.com"
+)
+
 type Client struct {
 	key                string
+	tokens             *tokenSource
 	basePath           string
 	metadataTemplateID string
+	apiURL             string
+	contentURL         string
+	notifyURL          string
 	client             *http.Client
+	maxRetries         int
+	baseRetryDelay     time.Duration
+	budget             *retryBudget
+	// listed is set once SubscribeMainFolder passed on the whole folder
+	listed atomic.Bool
+}
+
+// ClientOption changes where the client sends requests
+type ClientOption func(*Client)
+
+// WithAPIURL sends RPC requests to url instead of https://api.dropboxapi.com
+func WithAPIURL(url string) ClientOption {
+	return func(c *Client) {
+		c.apiURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithContentURL sends download requests to url instead of https://content.dropboxapi.com
+func WithContentURL(url string) ClientOption {
+	return func(c *Client) {
+		c.contentURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithNotifyURL sends longpoll requests to url instead of https://notify.dropboxapi.com
+func WithNotifyURL(url string) ClientOption {
+	return func(c *Client) {
+		c.notifyURL = strings.TrimSuffix(url, "/")
+	}
 }
 
-func NewClient(client *http.Client, key, path, metadataTemplateID string) *Client {
+func NewClient(client *http.Client, key, path, metadataTemplateID string, opts ...ClientOption) *Client {
 	if path == "" {
 		path = "/blog"
 	}
+	path = normalizeFolder(path)
 	if client == nil {
 		client = &http.Client{}
 	}
 
-	return &Client{
+	c := &Client{
 		client:             client,
 		key:                key,
 		basePath:           path,
-		metadataTemplateID: metadataTemplateID}
+		metadataTemplateID: metadataTemplateID,
+		apiURL:             defaultAPIURL,
+		contentURL:         defaultContentURL,
+		notifyURL:          defaultNotifyURL,
+		maxRetries:         defaultMaxRetries,
+		baseRetryDelay:     defaultRetryDelay,
+		budget:             newRetryBudget()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tokens != nil {
+		c.tokens.client = c.client
+		c.tokens.tokenURL = c.apiURL + "/oauth2/token"
+	}
+	return c
+}
+
+// normalizeFolder writes the folder like the path_lower of its entries, lower case with
+// a leading and without a trailing slash. The root folder is the empty path.
+func normalizeFolder(folder string) string {
+	folder = strings.Trim(strings.ToLower(folder), "/")
+	if folder == "" {
+		return ""
+	}
+	return "/" + folder
+}
+
+// WithRefreshToken authenticates with access tokens refreshed from the app's refresh token
+// instead of the static key
+func WithRefreshToken(appKey, appSecret, refreshToken string) ClientOption {
+	return func(c *Client) {
+		c.tokens = &tokenSource{
+			appKey:       appKey,
+			appSecret:    appSecret,
+			refreshToken: refreshToken,
+		}
+	}
 }
 
 type listFolderArg struct {
@@ -86,7 +230,7 @@ type propertyGroupsFilter struct {
 	List []string `json:"filter_some"`
 }
 
-func (c *Client) createFolderMetadataRequest() (*http.Request, error) {
+func (c *Client) createFolderMetadataRequest(ctx context.Context) (*http.Request, error) {
 	arg := &listFolderArg{
 		Path: c.basePath,
 		IncludePropertyGroups: propertyGroupsFilter{
@@ -97,116 +241,225 @@ func (c *Client) createFolderMetadataRequest() (*http.Request, error) {
 		IncludeDeleted:              false,
 	}
 
-	b, err := json.Marshal(arg)
-	if err != nil {
-		return nil, fmt.Errorf("marshalling args: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(
-		context.Background(),
-		"POST",
-		"https://api.dropboxapi.com/2/files/list_folder",
-		bytes.NewReader(b))
+	req, err := newRPCRequest(ctx, c.apiURL+"/2/files/list_folder", arg)
 	if err != nil {
 		return nil, fmt.Errorf("creating folder request: %w", err)
 	}
-	req.Header.Add("Authorization", "Bearer "+c.key)
-	req.Header.Add("Content-Type", "application/json")
-
 	return req, nil
 }
 
-func (c *Client) ListMainFolder(ctx context.Context) (fm *FolderMetadata, err error) {
+// ListMainFolder lists every entry in the blog folder, following the cursor until all pages are read
+func (c *Client) ListMainFolder(ctx context.Context) (*FolderMetadata, error) {
 
-	req, err := c.createFolderMetadataRequest()
+	req, err := c.createFolderMetadataRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.client.Do(req.WithContext(ctx))
+	fm := &FolderMetadata{}
+	err = c.doRPC(req, true, fm)
 	if err != nil {
 		return nil, fmt.Errorf("requesting folder metadata: %w", err)
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			err = errors.Join(err, closeErr)
-		}
-	}()
+	return c.remainingPages(ctx, fm)
+}
 
-	if resp.StatusCode != 200 {
-		code, err := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("requesting folder metadata: %s , %w", code, err)
-	}
+// continueMainFolder lists every change since the cursor as one batch
+func (c *Client) continueMainFolder(ctx context.Context, cursor string) (*FolderMetadata, error) {
 
-	decoder := json.NewDecoder(resp.Body)
-	data := &FolderMetadata{}
-	err = decoder.Decode(data)
+	fm, err := c.continueMainFolderPage(ctx, cursor)
 	if err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
+		return nil, err
 	}
-	return data, nil
+	return c.remainingPages(ctx, fm)
 }
 
-func (c *Client) continueMainFolder(ctx context.Context, cursor string) (fmd *FolderMetadata, err error) {
+// remainingPages appends the entries of the pages following fm to it
+func (c *Client) remainingPages(ctx context.Context, fm *FolderMetadata) (*FolderMetadata, error) {
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		"https://api.dropboxapi.com/2/files/list_folder/continue",
-		bytes.NewReader([]byte(fmt.Sprintf(`
-		{
-			"cursor":"%s"
-		}`, cursor))))
+	for fm.HasMore {
+		next, err := c.continueMainFolderPage(ctx, fm.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		fm.Entries = append(fm.Entries, next.Entries...)
+		fm.Cursor = next.Cursor
+		fm.HasMore = next.HasMore
+	}
+	return fm, nil
+}
+
+type listFolderContinueArg struct {
+	Cursor string `json:"cursor"`
+}
+
+func (c *Client) continueMainFolderPage(ctx context.Context, cursor string) (*FolderMetadata, error) {
+
+	req, err := newRPCRequest(ctx, c.apiURL+"/2/files/list_folder/continue", listFolderContinueArg{Cursor: cursor})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("creating folder request: %w", err)
 	}
-	req.Header.Add("Authorization", "Bearer "+c.key)
-	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := c.client.Do(req)
+	fm := &FolderMetadata{}
+	err = c.doRPC(req, true, fm)
 	if err != nil {
 		return nil, fmt.Errorf("requesting folder metadata: %w", err)
 	}
+	return fm, nil
+}
 
-	defer func() {
-		err = resp.Body.Close()
-	}()
-	if resp.StatusCode != 200 {
-		code, err := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("requesting folder metadata: %s , %w", code, err)
+type longpollArg struct {
+	Cursor  string `json:"cursor"`
+	Timeout int    `json:"timeout"`
+}
+
+type longpollResult struct {
+	Changes bool `json:"changes"`
+	Backoff int  `json:"backoff"`
+}
+
+// longpollTimeout is how many seconds Dropbox holds a longpoll request open without changes
+const longpollTimeout = 300
+
+// longpoll waits for changes since the cursor, backoff is how long to wait before polling again
+func (c *Client) longpoll(ctx context.Context, cursor string) (changes bool, backoff time.Duration, err error) {
+
+	req, err := newRPCRequest(
+		ctx,
+		c.notifyURL+"/2/files/list_folder/longpoll",
+		longpollArg{Cursor: cursor, Timeout: longpollTimeout})
+	if err != nil {
+		return false, 0, fmt.Errorf("creating longpoll request: %w", err)
 	}
 
-	decoder := json.NewDecoder(resp.Body)
-	fmd = &FolderMetadata{}
-	err = decoder.Decode(fmd)
+	// longpoll authenticates with the cursor only
+	res := longpollResult{}
+	err = c.doRPC(req, false, &res)
 	if err != nil {
-		return nil, fmt.Errorf("decoding response: %w", err)
+		return false, 0, fmt.Errorf("longpolling folder: %w", err)
 	}
-	return fmd, nil
+	return res.Changes, time.Duration(res.Backoff) * time.Second, nil
 }
 
-func (c *Client) SubscribeMainFolder(entriesChan chan<- EntryMetadata, done <-chan struct{}) error {
+// SyncRequest asks SubscribeMainFolder to sync now. A full sync lists the whole folder
+// again from a new cursor instead of the changes since the last one.
+type SyncRequest struct {
+	Full bool
+}
+
+// SubscribeMainFolder sends every entry in the blog folder to entriesChan, then every changed entry
+// as Dropbox reports changes or a sync is requested on syncRequests.
+// It returns nil when done is closed, and the error when listing fails.
+func (c *Client) SubscribeMainFolder(entriesChan chan<- EntryMetadata, syncRequests <-chan SyncRequest, done <-chan struct{}) error {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	initResults, err := c.ListMainFolder(context.Background())
+	initResults, err := c.ListMainFolder(ctx)
 	if err != nil {
-		return err
+		return ignoreCanceled(ctx, err)
 	}
-	for _, ent := range initResults.Entries {
-		entriesChan <- ent
+	lastSync.SetToCurrentTime()
+	if !sendEntries(entriesChan, initResults.Entries, done) {
+		return nil
 	}
-	ticker := time.NewTicker(1 * time.Second)
+	c.listed.Store(true)
+
 	cursor := initResults.Cursor
-	for range ticker.C {
-		res, err := c.continueMainFolder(context.Background(), cursor)
+	for {
+		changes, full, backoff, err := c.waitForChanges(ctx, cursor, syncRequests)
 		if err != nil {
-			panic(err)
+			return ignoreCanceled(ctx, err)
 		}
-		for _, ent := range res.Entries {
-			entriesChan <- ent
+		if full {
+			res, err := c.ListMainFolder(ctx)
+			if err != nil {
+				return ignoreCanceled(ctx, err)
+			}
+			for i := range res.Entries {
+				res.Entries[i].Relisted = true
+			}
+			if !sendEntries(entriesChan, res.Entries, done) {
+				return nil
+			}
+			cursor = res.Cursor
+		} else if changes {
+			res, err := c.continueMainFolder(ctx, cursor)
+			if err != nil {
+				return ignoreCanceled(ctx, err)
+			}
+			if !sendEntries(entriesChan, res.Entries, done) {
+				return nil
+			}
+			cursor = res.Cursor
+		}
+		lastSync.SetToCurrentTime()
+		if backoff > 0 {
+			select {
+			case <-done:
+				return nil
+			case <-time.After(backoff):
+			}
 		}
 	}
+}
 
-	return nil
+// Listed reports if SubscribeMainFolder has passed on every entry of the folder once
+func (c *Client) Listed() bool {
+	return c.listed.Load()
+}
+
+// waitForChanges longpolls for changes since the cursor, and stops waiting when a sync is requested.
+// full reports that a full sync was requested.
+func (c *Client) waitForChanges(ctx context.Context, cursor string, syncRequests <-chan SyncRequest) (changes, full bool, backoff time.Duration, err error) {
+
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		changes bool
+		backoff time.Duration
+		err     error
+	}
+	results := make(chan result, 1)
+	go func() {
+		changes, backoff, err := c.longpoll(pollCtx, cursor)
+		results <- result{changes, backoff, err}
+	}()
+
+	select {
+	case res := <-results:
+		return res.changes, false, res.backoff, res.err
+	case req := <-syncRequests:
+		return true, req.Full, 0, nil
+	}
+}
+
+// sendEntries reports false if done was closed before every entry was sent
+func sendEntries(entriesChan chan<- EntryMetadata, entries []EntryMetadata, done <-chan struct{}) bool {
+	for _, ent := range entries {
+		select {
+		case entriesChan <- ent:
+		case <-done:
+			return false
+		}
+	}
+	return true
+}
+
+// ignoreCanceled drops errors caused by the subscription being stopped
+func ignoreCanceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
 }
 
 func (c *Client) AnachromeMeta(emd EntryMetadata) (AnachromeMeta, error) {
@@ -233,6 +486,18 @@ func (c *Client) AnachromeMeta(emd EntryMetadata) (AnachromeMeta, error) {
 			if field.Name == "hash" {
 				am.Hash = field.Value
 			}
+			if field.Name == "tags" {
+				am.Tags = decodeList(field.Value)
+			}
+			if field.Name == "categories" {
+				am.Categories = decodeList(field.Value)
+			}
+			if field.Name == "summary" {
+				am.Summary = field.Value
+			}
+			if field.Name == "draft" {
+				am.Draft = field.Value == "true"
+			}
 
 		}
 		return am, nil
@@ -241,6 +506,10 @@ func (c *Client) AnachromeMeta(emd EntryMetadata) (AnachromeMeta, error) {
 	return am, nil
 }
 
+type downloadArg struct {
+	Path string `json:"path"`
+}
+
 type propertyArg struct {
 	Path                 string                 `json:"path"`
 	PropertyGroups       *[]propertyGroup       `json:"property_groups,omitempty"`
@@ -258,81 +527,200 @@ func (c *Client) UpdateEntryProperties(ctx context.Context, ent EntryMetadata, a
 	if len(*ent.PropertyGroups) == 1 {
 		mode = "update"
 		arg.UpdatePropertyGroups = &[]propertyGroupUpdate{{
-			TemplateID: c.metadataTemplateID,
-			AddOrUpdateFields: []field{
-				{Name: "title", Value: am.Title},
-				{Name: "published", Value: am.Published.String()},
-				{Name: "hash", Value: am.Hash},
-			}}}
+			TemplateID:        c.metadataTemplateID,
+			AddOrUpdateFields: am.fields()}}
 	} else {
 		arg.PropertyGroups = &[]propertyGroup{{
 			TemplateID: c.metadataTemplateID,
-			Fields: []field{
-				{Name: "title", Value: am.Title},
-				{Name: "published", Value: am.Published.String()},
-				{Name: "hash", Value: am.Hash},
-			}}}
+			Fields:     am.fields()}}
 	}
 
-	b, err := json.Marshal(arg)
-	if err != nil {
-		return fmt.Errorf("marshalling args: %w", err)
-	}
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		"https://api.dropboxapi.com/2/file_properties/properties/"+mode,
-		bytes.NewReader(b))
+	req, err := newRPCRequest(ctx, c.apiURL+"/2/file_properties/properties/"+mode, arg)
 	if err != nil {
 		return fmt.Errorf("creating file properties request: %w", err)
 	}
-	req.Header.Add("Authorization", "Bearer "+c.key)
-	req.Header.Add("Content-Type", "application/json")
-	resp, err := c.client.Do(req)
+	err = c.doRPC(req, true, nil)
 	if err != nil {
 		return fmt.Errorf("Add/Update file metadata: %w", err)
 	}
-	if resp.StatusCode != 200 {
-		code, err := io.ReadAll(resp.Body)
-		return fmt.Errorf("Add/Update file metadata: %s , %w", code, err)
+	return nil
+}
+
+type propertyFieldTemplate struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Type        propertyTag `json:"type"`
+}
+
+type propertyTag struct {
+	Tag string `json:".tag"`
+}
+
+type addTemplateArg struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Fields      []propertyFieldTemplate `json:"fields"`
+}
+
+type addTemplateResult struct {
+	TemplateID string `json:"template_id"`
+}
+
+// templateFields are the fields of the property template holding post metadata
+func templateFields() []propertyFieldTemplate {
+	var fields []propertyFieldTemplate
+	for _, f := range (AnachromeMeta{}).fields() {
+		fields = append(fields, propertyFieldTemplate{
+			Name:        f.Name,
+			Description: "Front matter " + f.Name,
+			Type:        propertyTag{Tag: "string"},
+		})
+	}
+	return fields
+}
+
+// AddPropertyTemplate creates the property template holding post metadata for the user and returns its ID
+func (c *Client) AddPropertyTemplate(ctx context.Context) (string, error) {
+
+	arg := addTemplateArg{
+		Name:        "Anachrome",
+		Description: "Blog post metadata synced from the front matter",
+		Fields:      templateFields(),
+	}
+
+	req, err := newRPCRequest(ctx, c.apiURL+"/2/file_properties/templates/add_for_user", arg)
+	if err != nil {
+		return "", fmt.Errorf("creating template request: %w", err)
+	}
+
+	res := addTemplateResult{}
+	err = c.doRPC(req, true, &res)
+	if err != nil {
+		return "", fmt.Errorf("adding property template: %w", err)
+	}
+	return res.TemplateID, nil
+}
+
+type templateArg struct {
+	TemplateID string `json:"template_id"`
+}
+
+type updateTemplateArg struct {
+	TemplateID string                  `json:"template_id"`
+	AddFields  []propertyFieldTemplate `json:"add_fields"`
+}
+
+// EnsurePropertyTemplate adds the fields of the post metadata that the configured
+// template lacks, templates created by older versions hold fewer fields
+func (c *Client) EnsurePropertyTemplate(ctx context.Context) error {
+
+	req, err := newRPCRequest(ctx, c.apiURL+"/2/file_properties/templates/get_for_user", templateArg{TemplateID: c.metadataTemplateID})
+	if err != nil {
+		return fmt.Errorf("creating template request: %w", err)
+	}
+	var template addTemplateArg
+	err = c.doRPC(req, true, &template)
+	if err != nil {
+		return fmt.Errorf("getting property template: %w", err)
+	}
+
+	arg := updateTemplateArg{TemplateID: c.metadataTemplateID}
+	for _, f := range templateFields() {
+		if !slices.ContainsFunc(template.Fields, func(t propertyFieldTemplate) bool { return t.Name == f.Name }) {
+			arg.AddFields = append(arg.AddFields, f)
+		}
+	}
+	if len(arg.AddFields) == 0 {
+		return nil
+	}
+	req, err = newRPCRequest(ctx, c.apiURL+"/2/file_properties/templates/update_for_user", arg)
+	if err != nil {
+		return fmt.Errorf("creating template request: %w", err)
+	}
+	err = c.doRPC(req, true, nil)
+	if err != nil {
+		return fmt.Errorf("updating property template: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) GetFileContent(ctx context.Context, id string) ([]byte, *EntryMetadata, error) {
+type checkUserArg struct {
+	Query string `json:"query"`
+}
 
-	path := c.basePath + "/" + id + ".md"
+// CheckUser verifies that the access token is valid, refreshing it when it expired
+func (c *Client) CheckUser(ctx context.Context) error {
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		"https://content.dropboxapi.com/2/files/download", nil)
+	req, err := newRPCRequest(ctx, c.apiURL+"/2/check/user", checkUserArg{Query: "anachrome"})
 	if err != nil {
-		return nil, nil, fmt.Errorf("creating file content request: %w", err)
+		return fmt.Errorf("creating check request: %w", err)
 	}
-	req.Header.Add("Authorization", "Bearer "+c.key)
-	req.Header.Add("Dropbox-API-Arg", fmt.Sprintf("{\"path\":\"%s\"}", path))
-	resp, err := c.client.Do(req)
+	err = c.doRPC(req, true, nil)
 	if err != nil {
-		return nil, nil, fmt.Errorf("downloading file content: %w", err)
+		return fmt.Errorf("checking user: %w", err)
 	}
-	if resp.StatusCode != 200 {
-		code, err := io.ReadAll(resp.Body)
-		return nil, nil, fmt.Errorf("downloading file content: %s , %w", code, err)
+	return nil
+}
+
+func (c *Client) GetFileContent(ctx context.Context, id string) (content []byte, meta *EntryMetadata, err error) {
+
+	body, meta, err := c.DownloadFile(ctx, id+".md")
+	if err != nil {
+		return nil, nil, err
 	}
 	defer func() {
-		err = resp.Body.Close()
+		if closeErr := body.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
 	}()
-	content, err := io.ReadAll(resp.Body)
+	content, err = io.ReadAll(body)
 	if err != nil {
 		return nil, nil, fmt.Errorf("reading file content: %w", err)
 	}
-	var meta EntryMetadata
-	err = json.Unmarshal([]byte(resp.Header["Dropbox-Api-Result"][0]), &meta)
+	return content, meta, nil
+}
+
+// DownloadFile streams the file at the path relative to the blog folder, the caller closes the content
+func (c *Client) DownloadFile(ctx context.Context, name string) (io.ReadCloser, *EntryMetadata, error) {
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		c.contentURL+"/2/files/download", nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating file content request: %w", err)
+	}
+	arg, err := json.Marshal(downloadArg{Path: c.basePath + "/" + name})
 	if err != nil {
+		return nil, nil, fmt.Errorf("marshalling args: %w", err)
+	}
+	req.Header.Add("Dropbox-API-Arg", httpHeaderSafeJSON(arg))
+	resp, err := c.execute(req, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("downloading file content: %w", err)
+	}
+	meta := &EntryMetadata{}
+	err = json.Unmarshal([]byte(resp.Header.Get("Dropbox-API-Result")), meta)
+	if err != nil {
+		_ = resp.Body.Close()
 		return nil, nil, fmt.Errorf("reading file content: %w", err)
 	}
-	return content, &meta, err
+	return resp.Body, meta, nil
+}
+
+// httpHeaderSafeJSON escapes the non-ASCII characters of JSON for Dropbox-API-Arg headers
+func httpHeaderSafeJSON(b []byte) string {
+	sb := strings.Builder{}
+	for _, r := range string(b) {
+		if r < 0x7f {
+			sb.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&sb, "\\u%04x", u)
+		}
+	}
+	return sb.String()
 }
 
 func (c *Client) GetID(entry EntryMetadata) string {
@@ -1,10 +1,17 @@
 package dropbox
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestNewClient(t *testing.T) {
@@ -32,8 +39,14 @@ func TestNewClient(t *testing.T) {
 			&Client{
 				client:             httpClient,
 				key:                "key",
-				basePath:           "path",
+				basePath:           "/path",
 				metadataTemplateID: "id",
+				apiURL:             defaultAPIURL,
+				contentURL:         defaultContentURL,
+				notifyURL:          defaultNotifyURL,
+				maxRetries:         defaultMaxRetries,
+				baseRetryDelay:     defaultRetryDelay,
+				budget:             newRetryBudget(),
 			}},
 	}
 	for _, tt := range tests {
@@ -49,6 +62,21 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestClient_GetID(t *testing.T) {
+
+	entry := EntryMetadata{PathLower: "/my blog/hello.md", PathDisplay: "/My Blog/Hello.md"}
+	for _, folder := range []string{"/My Blog", "My Blog/", "/my blog/"} {
+		c := NewClient(nil, "key", folder, "id")
+		if got := c.GetID(entry); got != "hello" {
+			t.Errorf("GetID() in folder %q = %q, want hello", folder, got)
+		}
+	}
+	c := NewClient(nil, "key", "/", "id")
+	if got := c.GetID(EntryMetadata{PathLower: "/hello.md"}); got != "hello" {
+		t.Errorf("GetID() in root folder = %q, want hello", got)
+	}
+}
+
 func TestClient_AnachromeMeta(t *testing.T) {
 
 	tmpDate := time.Date(2006, 01, 02, 15, 04, 05, 0, time.UTC)
@@ -87,6 +115,45 @@ func TestClient_AnachromeMeta(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Should create with tags, categories, summary and draft",
+			NewClient(nil, "key", "path", "metadata"),
+			EntryMetadata{
+				PropertyGroups: &[]propertyGroup{
+					{TemplateID: "metadata",
+						Fields: []field{
+							{Name: "title", Value: "title 1"},
+							{Name: "tags", Value: "go, web,"},
+							{Name: "categories", Value: ""},
+							{Name: "summary", Value: "summary 1"},
+							{Name: "draft", Value: "true"},
+						}},
+				},
+			},
+			AnachromeMeta{
+				Title:   "title 1",
+				Tags:    []string{"go", "web"},
+				Summary: "summary 1",
+				Draft:   true,
+			},
+			false,
+		},
+		{
+			"Should create with JSON lists",
+			NewClient(nil, "key", "path", "metadata"),
+			EntryMetadata{
+				PropertyGroups: &[]propertyGroup{
+					{TemplateID: "metadata",
+						Fields: []field{
+							{Name: "tags", Value: `["go","hello, world"]`},
+						}},
+				},
+			},
+			AnachromeMeta{
+				Tags: []string{"go", "hello, world"},
+			},
+			false,
+		},
 		{
 			"Should fail on date metadata",
 			NewClient(nil, "key", "path", "metadata"),
@@ -117,3 +184,336 @@ func TestClient_AnachromeMeta(t *testing.T) {
 		})
 	}
 }
+
+// fakeFolderAPI serves list_folder pages, continue pages are looked up by cursor
+func fakeFolderAPI(t *testing.T, first FolderMetadata, pages map[string]FolderMetadata) (*Client, *http.ServeMux) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /2/files/list_folder", func(w http.ResponseWriter, r *http.Request) {
+		var arg listFolderArg
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil || arg.Path != "/blog" {
+			http.Error(w, "bad list_folder arg", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(first)
+	})
+	mux.HandleFunc("POST /2/files/list_folder/continue", func(w http.ResponseWriter, r *http.Request) {
+		var arg listFolderContinueArg
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, ok := pages[arg.Cursor]
+		if !ok {
+			http.Error(w, `{"error_summary": "reset/"}`, http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c := NewClient(srv.Client(), "key", "", "metadata", WithAPIURL(srv.URL), WithNotifyURL(srv.URL+"/"))
+	return c, mux
+}
+
+func entryNames(fm *FolderMetadata) []string {
+	names := make([]string, 0, len(fm.Entries))
+	for _, ent := range fm.Entries {
+		names = append(names, ent.Name)
+	}
+	return names
+}
+
+func TestClient_ListMainFolder(t *testing.T) {
+
+	c, _ := fakeFolderAPI(t,
+		FolderMetadata{Entries: []EntryMetadata{{Name: "a.md"}}, Cursor: "c1", HasMore: true},
+		map[string]FolderMetadata{
+			"c1": {Entries: []EntryMetadata{{Name: "b.md"}}, Cursor: "c2", HasMore: true},
+			"c2": {Entries: []EntryMetadata{{Name: "c.md"}}, Cursor: "c3"},
+		})
+
+	fm, err := c.ListMainFolder(context.Background())
+	if err != nil {
+		t.Fatalf("Client.ListMainFolder() error = %v", err)
+	}
+	if got, want := entryNames(fm), []string{"a.md", "b.md", "c.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Client.ListMainFolder() entries = %v, want %v", got, want)
+	}
+	if fm.Cursor != "c3" || fm.HasMore {
+		t.Errorf("Client.ListMainFolder() cursor = %s, has more %v, want c3 and false", fm.Cursor, fm.HasMore)
+	}
+}
+
+func TestClient_continueMainFolder(t *testing.T) {
+
+	c, _ := fakeFolderAPI(t,
+		FolderMetadata{},
+		map[string]FolderMetadata{
+			"c3": {Entries: []EntryMetadata{{Name: "d.md"}}, Cursor: "c4", HasMore: true},
+			"c4": {Cursor: "c5", HasMore: true},
+			"c5": {Entries: []EntryMetadata{{Name: "e.md"}, {Name: "f.md"}}, Cursor: "c6"},
+		})
+
+	fm, err := c.continueMainFolder(context.Background(), "c3")
+	if err != nil {
+		t.Fatalf("Client.continueMainFolder() error = %v", err)
+	}
+	if got, want := entryNames(fm), []string{"d.md", "e.md", "f.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Client.continueMainFolder() entries = %v, want %v", got, want)
+	}
+	if fm.Cursor != "c6" {
+		t.Errorf("Client.continueMainFolder() cursor = %s, want c6", fm.Cursor)
+	}
+
+	_, err = c.continueMainFolder(context.Background(), "expired")
+	if err == nil {
+		t.Error("Client.continueMainFolder() with an unknown cursor should fail")
+	}
+}
+
+func TestClient_SubscribeMainFolder(t *testing.T) {
+
+	c, mux := fakeFolderAPI(t,
+		FolderMetadata{Entries: []EntryMetadata{{Name: "a.md"}}, Cursor: "c1", HasMore: true},
+		map[string]FolderMetadata{
+			"c1": {Entries: []EntryMetadata{{Name: "b.md"}}, Cursor: "c2"},
+			"c2": {Entries: []EntryMetadata{{Name: "c.md"}}, Cursor: "c3", HasMore: true},
+			"c3": {Entries: []EntryMetadata{{Name: "d.md"}}, Cursor: "c4"},
+		})
+	polled := make(chan string, 10)
+	mux.HandleFunc("POST /2/files/list_folder/longpoll", func(w http.ResponseWriter, r *http.Request) {
+		var arg longpollArg
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "longpoll takes no authorization", http.StatusBadRequest)
+			return
+		}
+		polled <- arg.Cursor
+		// Changes since the first cursor, then nothing and a long backoff
+		json.NewEncoder(w).Encode(longpollResult{Changes: arg.Cursor == "c2", Backoff: 60})
+	})
+
+	if c.Listed() {
+		t.Error("Client.Listed() before subscribing")
+	}
+	entriesChan := make(chan EntryMetadata)
+	done := make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- c.SubscribeMainFolder(entriesChan, nil, done)
+	}()
+
+	var names []string
+	for range 4 {
+		select {
+		case ent := <-entriesChan:
+			names = append(names, ent.Name)
+		case err := <-errChan:
+			t.Fatalf("Client.SubscribeMainFolder() returned early, error = %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for entries, got %v", names)
+		}
+	}
+	if want := []string{"a.md", "b.md", "c.md", "d.md"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Client.SubscribeMainFolder() entries = %v, want %v", names, want)
+	}
+	if cursor := <-polled; cursor != "c2" {
+		t.Errorf("first longpoll cursor = %s, want c2", cursor)
+	}
+	if !c.Listed() {
+		t.Error("Client.Listed() = false after the folder was passed on")
+	}
+
+	close(done)
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("Client.SubscribeMainFolder() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client.SubscribeMainFolder() did not stop when done was closed")
+	}
+}
+
+func TestClient_SubscribeMainFolderError(t *testing.T) {
+
+	c, mux := fakeFolderAPI(t, FolderMetadata{Cursor: "c1"}, nil)
+	mux.HandleFunc("POST /2/files/list_folder/longpoll", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error_summary": "reset/"}`, http.StatusConflict)
+	})
+
+	err := c.SubscribeMainFolder(make(chan EntryMetadata), nil, make(chan struct{}))
+	if err == nil {
+		t.Error("Client.SubscribeMainFolder() should return the longpoll error")
+	}
+}
+
+func TestClient_SubscribeMainFolderSyncRequest(t *testing.T) {
+
+	c, mux := fakeFolderAPI(t,
+		FolderMetadata{Cursor: "c1"},
+		map[string]FolderMetadata{
+			"c1": {Entries: []EntryMetadata{{Name: "a.md"}}, Cursor: "c2"},
+		})
+	mux.HandleFunc("POST /2/files/list_folder/longpoll", func(w http.ResponseWriter, r *http.Request) {
+		// Times out without changes
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(longpollResult{})
+	})
+
+	entriesChan := make(chan EntryMetadata)
+	syncRequests := make(chan SyncRequest, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go c.SubscribeMainFolder(entriesChan, syncRequests, done)
+
+	syncRequests <- SyncRequest{}
+	select {
+	case ent := <-entriesChan:
+		if ent.Name != "a.md" {
+			t.Errorf("synced entry = %s, want a.md", ent.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync request did not list changes")
+	}
+}
+
+func TestClient_SubscribeMainFolderFullSync(t *testing.T) {
+
+	c, mux := fakeFolderAPI(t, FolderMetadata{Entries: []EntryMetadata{{Name: "a.md"}}, Cursor: "c1"}, nil)
+	mux.HandleFunc("POST /2/files/list_folder/longpoll", func(w http.ResponseWriter, r *http.Request) {
+		// Times out without changes
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(longpollResult{})
+	})
+
+	entriesChan := make(chan EntryMetadata)
+	syncRequests := make(chan SyncRequest, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go c.SubscribeMainFolder(entriesChan, syncRequests, done)
+
+	next := func() EntryMetadata {
+		select {
+		case ent := <-entriesChan:
+			return ent
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for entries")
+			return EntryMetadata{}
+		}
+	}
+	if ent := next(); ent.Name != "a.md" || ent.Relisted {
+		t.Errorf("listed entry = %+v, want a.md", ent)
+	}
+	// A full sync lists the folder again instead of continuing from the cursor
+	syncRequests <- SyncRequest{Full: true}
+	if ent := next(); ent.Name != "a.md" || !ent.Relisted {
+		t.Errorf("relisted entry = %+v, want a.md relisted", ent)
+	}
+}
+
+func TestClient_AddPropertyTemplate(t *testing.T) {
+
+	c, mux := fakeFolderAPI(t, FolderMetadata{}, nil)
+	mux.HandleFunc("POST /2/file_properties/templates/add_for_user", func(w http.ResponseWriter, r *http.Request) {
+		var arg addTemplateArg
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(arg.Fields) != len((AnachromeMeta{}).fields()) || arg.Fields[0].Type.Tag != "string" {
+			http.Error(w, "unexpected fields", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(addTemplateResult{TemplateID: "ptid:new"})
+	})
+
+	id, err := c.AddPropertyTemplate(context.Background())
+	if err != nil {
+		t.Fatalf("Client.AddPropertyTemplate() error = %v", err)
+	}
+	if id != "ptid:new" {
+		t.Errorf("Client.AddPropertyTemplate() = %s, want ptid:new", id)
+	}
+}
+
+func TestAnachromeMeta_fields(t *testing.T) {
+
+	long := strings.Repeat("å", maxPropertyValueBytes)
+	am := AnachromeMeta{
+		Title:   long,
+		Summary: long,
+		Tags:    []string{"hello, world", long},
+	}
+	values := map[string]string{}
+	for _, f := range am.fields() {
+		values[f.Name] = f.Value
+		if len(f.Value) > maxPropertyValueBytes || !utf8.ValidString(f.Value) {
+			t.Errorf("AnachromeMeta.fields() %s has %d bytes, want valid UTF-8 within %d", f.Name, len(f.Value), maxPropertyValueBytes)
+		}
+	}
+	if values["tags"] != `["hello, world"]` {
+		t.Errorf("AnachromeMeta.fields() tags = %s, want the items that fit", values["tags"])
+	}
+	if values["summary"] != long[:maxPropertyValueBytes] {
+		t.Errorf("AnachromeMeta.fields() summary has %d bytes, want %d", len(values["summary"]), maxPropertyValueBytes)
+	}
+}
+
+func TestClient_EnsurePropertyTemplate(t *testing.T) {
+
+	c, mux := fakeFolderAPI(t, FolderMetadata{}, nil)
+	mux.HandleFunc("POST /2/file_properties/templates/get_for_user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(addTemplateArg{Name: "Anachrome", Fields: templateFields()[:3]})
+	})
+	var added []string
+	mux.HandleFunc("POST /2/file_properties/templates/update_for_user", func(w http.ResponseWriter, r *http.Request) {
+		var arg updateTemplateArg
+		if err := json.NewDecoder(r.Body).Decode(&arg); err != nil || arg.TemplateID != "metadata" {
+			http.Error(w, "bad update arg", http.StatusBadRequest)
+			return
+		}
+		for _, f := range arg.AddFields {
+			added = append(added, f.Name)
+		}
+		json.NewEncoder(w).Encode(templateArg{TemplateID: arg.TemplateID})
+	})
+
+	err := c.EnsurePropertyTemplate(context.Background())
+	if err != nil {
+		t.Fatalf("Client.EnsurePropertyTemplate() error = %v", err)
+	}
+	if want := []string{"tags", "categories", "summary", "draft"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("Client.EnsurePropertyTemplate() added %v, want %v", added, want)
+	}
+}
+
+func TestClient_CheckUser(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /2/check/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, `{"error_summary": "invalid_access_token/"}`, http.StatusUnauthorized)
+			return
+		}
+		io.Copy(w, r.Body)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), "key", "", "metadata", WithAPIURL(srv.URL))
+	if err := c.CheckUser(context.Background()); err != nil {
+		t.Errorf("Client.CheckUser() error = %v", err)
+	}
+	c = NewClient(srv.Client(), "revoked", "", "metadata", WithAPIURL(srv.URL))
+	var apiErr *APIError
+	if err := c.CheckUser(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Client.CheckUser() error = %v, want 401", err)
+	}
+}
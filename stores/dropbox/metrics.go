@@ -0,0 +1,58 @@
+package dropbox
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anachrome_dropbox_requests_total",
+		Help: "Dropbox API calls by endpoint, a call includes its retries.",
+	}, []string{"endpoint"})
+	apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anachrome_dropbox_errors_total",
+		Help: "Failed Dropbox API calls by endpoint and reason, the status code or network.",
+	}, []string{"endpoint", "reason"})
+	apiDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "anachrome_dropbox_request_duration_seconds",
+		Help: "Time of Dropbox API calls by endpoint, a call includes its retries.",
+		// Longpolls take up to minutes
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"endpoint"})
+	lastSync = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anachrome_dropbox_last_sync_timestamp_seconds",
+		Help: "When the folder was last known to be in sync with Dropbox.",
+	})
+)
+
+// observeRequest records a call to the endpoint. Canceled calls are not errors,
+// longpolls are canceled whenever a sync is requested.
+func observeRequest(endpoint string, d time.Duration, err error) {
+
+	apiRequests.WithLabelValues(endpoint).Inc()
+	apiDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	apiErrors.WithLabelValues(endpoint, errorReason(err)).Inc()
+}
+
+func errorReason(err error) string {
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.StatusCode)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "network"
+}
@@ -0,0 +1,265 @@
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/zaker/anachrome-be/stores/dropbox")
+
+const (
+	defaultMaxRetries = 4
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+)
+
+// APIError is an error response from the Dropbox API
+type APIError struct {
+	StatusCode int
+	// Summary is the error_summary of structured errors, like path/not_found/..,
+	// or the body of other errors
+	Summary string
+	// Tag is the .tag of the endpoint specific error
+	Tag string
+	// RetryAfter is how long Dropbox asks to wait before retrying
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("dropbox: %d %s", e.StatusCode, e.Summary)
+}
+
+// Temporary reports if the request may succeed when retried
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsNotFound reports if err is Dropbox not finding the path
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Summary, "not_found")
+}
+
+// readAPIError decodes the error in a response, structured or not
+func readAPIError(resp *http.Response) *APIError {
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var structured struct {
+		ErrorSummary string `json:"error_summary"`
+		Error        struct {
+			Tag    string `json:".tag"`
+			Reason struct {
+				Tag string `json:".tag"`
+			} `json:"reason"`
+			RetryAfter int `json:"retry_after"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &structured) == nil && len(structured.ErrorSummary) > 0 {
+		apiErr.Summary = structured.ErrorSummary
+		apiErr.Tag = structured.Error.Tag
+		if len(apiErr.Tag) == 0 {
+			apiErr.Tag = structured.Error.Reason.Tag
+		}
+		apiErr.RetryAfter = time.Duration(structured.Error.RetryAfter) * time.Second
+	} else {
+		apiErr.Summary = strings.TrimSpace(string(body))
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// retryBudget stops retries while most requests fail, so that an outage is not made worse.
+// Failures spend a token and successes earn a fraction of one back, retries need half the tokens.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+func newRetryBudget() *retryBudget {
+	return &retryBudget{tokens: 10, max: 10, ratio: 0.1}
+}
+
+func (rb *retryBudget) success() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.tokens = min(rb.max, rb.tokens+rb.ratio)
+}
+
+// failure reports if the failed request may be retried
+func (rb *retryBudget) failure() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.tokens = max(0, rb.tokens-1)
+	return rb.tokens > rb.max/2
+}
+
+// retryDelay is exponential in the attempt with full jitter
+func (c *Client) retryDelay(attempt int) time.Duration {
+	d := min(c.baseRetryDelay<<attempt, maxRetryDelay)
+	return rand.N(d) + 1
+}
+
+// execute sends the request, authenticated with an access token unless it authenticates otherwise.
+// Rate limited, failing and unauthorized requests are retried within the retry budget.
+// It returns the response when it succeeds, error responses are returned as *APIError.
+func (c *Client) execute(req *http.Request, authenticated bool) (*http.Response, error) {
+
+	ctx, span := tracer.Start(req.Context(), "dropbox "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+		))
+	defer span.End()
+
+	start := time.Now()
+	resp, err := c.executeWithRetries(req.WithContext(ctx), authenticated)
+	d := time.Since(start)
+	observeRequest(req.URL.Path, d, err)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.WarnContext(ctx, "dropbox request failed", slog.String("endpoint", req.URL.Path), slog.Duration("duration", d), slog.Any("err", err))
+		return resp, err
+	}
+	slog.DebugContext(ctx, "dropbox request", slog.String("endpoint", req.URL.Path), slog.Duration("duration", d))
+	return resp, err
+}
+
+// executeWithRetries is execute without recording the metrics
+func (c *Client) executeWithRetries(req *http.Request, authenticated bool) (*http.Response, error) {
+
+	ctx := req.Context()
+	rejected := ""
+	for attempt := 0; ; attempt++ {
+
+		attemptReq := req.Clone(ctx)
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("cannot retry request without rewindable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("rewinding request body: %w", err)
+			}
+			attemptReq.Body = body
+		}
+
+		token := c.key
+		if authenticated && c.tokens != nil {
+			var err error
+			token, err = c.tokens.token(ctx, rejected)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if authenticated {
+			attemptReq.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		var wait time.Duration
+		resp, err := c.client.Do(attemptReq)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		case resp.StatusCode == http.StatusOK:
+			c.budget.success()
+			return resp, nil
+		default:
+			apiErr := readAPIError(resp)
+			_ = resp.Body.Close()
+			err = apiErr
+			if apiErr.StatusCode == http.StatusUnauthorized && authenticated && c.tokens != nil && len(rejected) == 0 {
+				// The token was revoked or expired early, refresh it once
+				rejected = token
+				attempt--
+				continue
+			}
+			if !apiErr.Temporary() {
+				return nil, apiErr
+			}
+			wait = apiErr.RetryAfter
+		}
+
+		if attempt >= c.maxRetries || !c.budget.failure() {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.retryDelay(attempt)
+		}
+		slog.DebugContext(ctx, "retrying dropbox request", slog.String("endpoint", req.URL.Path),
+			slog.Int("attempt", attempt+1), slog.Duration("wait", wait), slog.Any("err", err))
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.String("error", err.Error()),
+			attribute.String("wait", wait.String())))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// newRPCRequest creates a request to an RPC endpoint with the JSON encoded argument
+func newRPCRequest(ctx context.Context, url string, arg any) (*http.Request, error) {
+
+	b, err := json.Marshal(arg)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling args: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	return req, nil
+}
+
+// doRPC executes the RPC request and decodes the JSON result into res, unless res is nil
+func (c *Client) doRPC(req *http.Request, authenticated bool, res any) (err error) {
+
+	resp, err := c.execute(req, authenticated)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+	if res == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
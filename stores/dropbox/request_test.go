@@ -0,0 +1,171 @@
+package dropbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReadAPIError(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		status       int
+		header       http.Header
+		body         string
+		want         APIError
+		wantNotFound bool
+	}{
+		{"Endpoint error", http.StatusConflict, nil,
+			`{"error_summary": "path/not_found/..", "error": {".tag": "path", "path": {".tag": "not_found"}}}`,
+			APIError{StatusCode: 409, Summary: "path/not_found/..", Tag: "path"}, true},
+		{"Rate limited", http.StatusTooManyRequests, http.Header{"Retry-After": {"15"}},
+			`{"error_summary": "too_many_requests/..", "error": {"reason": {".tag": "too_many_requests"}, "retry_after": 300}}`,
+			APIError{StatusCode: 429, Summary: "too_many_requests/..", Tag: "too_many_requests", RetryAfter: 15 * time.Second}, false},
+		{"Rate limited without header", http.StatusTooManyRequests, nil,
+			`{"error_summary": "too_many_write_operations/..", "error": {"reason": {".tag": "too_many_write_operations"}, "retry_after": 1}}`,
+			APIError{StatusCode: 429, Summary: "too_many_write_operations/..", Tag: "too_many_write_operations", RetryAfter: time.Second}, false},
+		{"Bad input", http.StatusBadRequest, nil,
+			"Error in call to API function \"files/list_folder\": request body: could not decode input as JSON\n",
+			APIError{StatusCode: 400, Summary: "Error in call to API function \"files/list_folder\": request body: could not decode input as JSON"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			for k, v := range tt.header {
+				rec.Header()[k] = v
+			}
+			rec.WriteHeader(tt.status)
+			rec.WriteString(tt.body)
+
+			got := readAPIError(rec.Result())
+			if *got != tt.want {
+				t.Errorf("readAPIError() = %+v, want %+v", *got, tt.want)
+			}
+			if IsNotFound(got) != tt.wantNotFound {
+				t.Errorf("IsNotFound() = %v, want %v", !tt.wantNotFound, tt.wantNotFound)
+			}
+		})
+	}
+}
+
+// flakyClient answers list_folder with the statuses in turn, then succeeds
+func flakyClient(t *testing.T, statuses ...int) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !strings.Contains(string(body), `"path":"/blog"`) {
+			http.Error(w, "body not replayed", http.StatusBadRequest)
+			return
+		}
+		if n <= len(statuses) {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error_summary": "internal_error/"}`, statuses[n-1])
+			return
+		}
+		w.Write([]byte(`{"entries": [], "cursor": "c1"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(srv.Client(), "key", "", "metadata", WithAPIURL(srv.URL))
+	c.baseRetryDelay = time.Millisecond
+	return c, &calls
+}
+
+func TestClient_execute(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantErr   int
+		wantCalls int32
+	}{
+		{"Succeeds", nil, 0, 1},
+		{"Retries rate limits and server errors", []int{429, 503, 500}, 0, 4},
+		{"Gives up after the retries", []int{503, 503, 503, 503, 503, 503}, 503, 5},
+		{"Does not retry endpoint errors", []int{409}, 409, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, calls := flakyClient(t, tt.statuses...)
+			_, err := c.ListMainFolder(context.Background())
+
+			var apiErr *APIError
+			if tt.wantErr == 0 && err != nil {
+				t.Errorf("Client.ListMainFolder() error = %v", err)
+			}
+			if tt.wantErr != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantErr) {
+				t.Errorf("Client.ListMainFolder() error = %v, want status %d", err, tt.wantErr)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("requests = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClient_executeCanceled(t *testing.T) {
+
+	c, _ := flakyClient(t, 503, 503)
+	c.baseRetryDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.ListMainFolder(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Client.ListMainFolder() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestClient_executeMetrics(t *testing.T) {
+
+	const endpoint = "/2/files/list_folder"
+	requests := func() float64 { return testutil.ToFloat64(apiRequests.WithLabelValues(endpoint)) }
+	errs := func(reason string) float64 { return testutil.ToFloat64(apiErrors.WithLabelValues(endpoint, reason)) }
+	requestsBefore, conflictsBefore := requests(), errs("409")
+
+	c, _ := flakyClient(t, 503)
+	if _, err := c.ListMainFolder(context.Background()); err != nil {
+		t.Fatalf("Client.ListMainFolder() error = %v", err)
+	}
+	c, _ = flakyClient(t, 409)
+	if _, err := c.ListMainFolder(context.Background()); err == nil {
+		t.Fatal("Client.ListMainFolder() should fail")
+	}
+
+	if n := requests() - requestsBefore; n != 2 {
+		t.Errorf("requests = %v, want 2, retries are part of the call", n)
+	}
+	if n := errs("409") - conflictsBefore; n != 1 {
+		t.Errorf("errors = %v, want 1", n)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+
+	rb := newRetryBudget()
+	allowed := 0
+	for rb.failure() {
+		allowed++
+	}
+	if allowed != 4 {
+		t.Errorf("retries allowed while failing = %d, want 4", allowed)
+	}
+	for range 20 {
+		rb.success()
+	}
+	if !rb.failure() {
+		t.Error("retries should be allowed again after successes")
+	}
+}
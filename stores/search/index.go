@@ -0,0 +1,314 @@
+package search
+
+import (
+	"context"
+	"html"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+// titleBoost is how much more a match in the title counts than one in the content
+const titleBoost = 3.0
+
+// Result is a post matching a search with a highlighted snippet of its content
+type Result struct {
+	Meta    blog.BlogPostMeta `json:"meta"`
+	Score   float64           `json:"score"`
+	Snippet string            `json:"snippet"`
+}
+
+type document struct {
+	meta    blog.BlogPostMeta
+	content string
+	// tokens of the content, the title is indexed before them
+	tokens   []token
+	titleLen int
+}
+
+// Index is an in-process inverted index over post titles and content
+type Index struct {
+	blogs blog.BlogStore
+
+	mu   sync.RWMutex
+	docs map[string]*document
+	// terms maps a stemmed term to the positions it has in each document
+	terms map[string]map[string][]int
+}
+
+func NewIndex(blogs blog.BlogStore) *Index {
+	return &Index{
+		blogs: blogs,
+		docs:  make(map[string]*document),
+		terms: make(map[string]map[string][]int),
+	}
+}
+
+// Rebuild indexes every post in the blog store, and drops posts it no longer lists
+func (idx *Index) Rebuild(ctx context.Context) error {
+
+	metas, err := idx.blogs.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	for id := range idx.docs {
+		if !slices.ContainsFunc(metas, func(meta blog.BlogPostMeta) bool { return meta.ID == id }) {
+			idx.removeLocked(id)
+		}
+	}
+	idx.mu.Unlock()
+	for _, meta := range metas {
+		post, err := idx.blogs.GetBlogPost(ctx, meta.ID)
+		if err != nil {
+			slog.WarnContext(ctx, "indexing blog post", slog.String("id", meta.ID), slog.Any("err", err))
+			continue
+		}
+		idx.add(meta, post.Content)
+	}
+	return nil
+}
+
+// Invalidate reindexes a changed post, or removes it when it is no longer listed
+func (idx *Index) Invalidate(ctx context.Context, id string) error {
+
+	metas, err := idx.blogs.GetBlogPostsMeta(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(metas, func(meta blog.BlogPostMeta) bool { return meta.ID == id })
+	if i < 0 {
+		idx.remove(id)
+		return nil
+	}
+	post, err := idx.blogs.GetBlogPost(ctx, id)
+	if err != nil {
+		return err
+	}
+	idx.add(metas[i], post.Content)
+	return nil
+}
+
+func (idx *Index) add(meta blog.BlogPostMeta, content string) {
+
+	titleTokens := tokenize(meta.Title)
+	doc := &document{
+		meta:     meta,
+		content:  content,
+		tokens:   tokenize(content),
+		titleLen: len(titleTokens),
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(meta.ID)
+	idx.docs[meta.ID] = doc
+
+	// Leave a gap between the title and content so phrases don't span both
+	pos := 0
+	for _, tok := range append(titleTokens, token{}) {
+		if tok.term != "" {
+			idx.addTermLocked(stem(tok.term), meta.ID, pos)
+		}
+		pos++
+	}
+	for _, tok := range doc.tokens {
+		idx.addTermLocked(stem(tok.term), meta.ID, pos)
+		pos++
+	}
+}
+
+func (idx *Index) addTermLocked(term, id string, pos int) {
+	postings, ok := idx.terms[term]
+	if !ok {
+		postings = make(map[string][]int)
+		idx.terms[term] = postings
+	}
+	postings[id] = append(postings[id], pos)
+}
+
+func (idx *Index) remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+}
+
+func (idx *Index) removeLocked(id string) {
+	if _, ok := idx.docs[id]; !ok {
+		return
+	}
+	delete(idx.docs, id)
+	for term, postings := range idx.terms {
+		delete(postings, id)
+		if len(postings) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+}
+
+// Search finds the posts matching every part of the query, best matches first
+func (idx *Index) Search(query string, limit int) []Result {
+
+	clauses := parseQuery(query)
+	results := make([]Result, 0)
+	if len(clauses) == 0 {
+		return results
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// matches holds the positions matched in each document that matched every clause so far
+	var matches map[string][]int
+	var score map[string]float64
+	for _, cl := range clauses {
+		clauseMatches := idx.matchClauseLocked(cl)
+		if matches == nil {
+			matches = make(map[string][]int)
+			score = make(map[string]float64)
+			for id := range clauseMatches {
+				matches[id] = nil
+			}
+		}
+		idf := math.Log(1 + float64(len(idx.docs))/float64(1+len(clauseMatches)))
+		for id := range matches {
+			positions, ok := clauseMatches[id]
+			if !ok {
+				delete(matches, id)
+				continue
+			}
+			matches[id] = append(matches[id], positions...)
+			score[id] += idx.termScoreLocked(id, positions) * idf
+		}
+	}
+
+	for id, positions := range matches {
+		doc := idx.docs[id]
+		results = append(results, Result{
+			Meta:    doc.meta,
+			Score:   math.Round(score[id]*1000) / 1000,
+			Snippet: doc.snippet(positions),
+		})
+	}
+	slices.SortFunc(results, func(a, b Result) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Meta.ID, b.Meta.ID)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// termScoreLocked weighs the matches by their frequency in the document
+func (idx *Index) termScoreLocked(id string, positions []int) float64 {
+	doc := idx.docs[id]
+	tf := 0.0
+	for _, pos := range positions {
+		if pos < doc.titleLen {
+			tf += titleBoost
+		} else {
+			tf++
+		}
+	}
+	return tf / math.Sqrt(float64(doc.titleLen+len(doc.tokens)+1))
+}
+
+// matchClauseLocked finds the positions matching a clause in each document
+func (idx *Index) matchClauseLocked(cl clause) map[string][]int {
+
+	if cl.prefix {
+		matches := make(map[string][]int)
+		for term, postings := range idx.terms {
+			if !slices.ContainsFunc(cl.terms, func(prefix string) bool { return strings.HasPrefix(term, prefix) }) {
+				continue
+			}
+			for id, positions := range postings {
+				matches[id] = append(matches[id], positions...)
+			}
+		}
+		return matches
+	}
+
+	first := idx.terms[cl.terms[0]]
+	matches := make(map[string][]int)
+	for id, positions := range first {
+		for _, pos := range positions {
+			if idx.phraseAtLocked(cl.terms, id, pos) {
+				for i := range cl.terms {
+					matches[id] = append(matches[id], pos+i)
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func (idx *Index) phraseAtLocked(terms []string, id string, pos int) bool {
+	for i, term := range terms[1:] {
+		if !slices.Contains(idx.terms[term][id], pos+i+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// snippetWords is the number of words around the first match in a snippet
+const snippetWords = 12
+
+// snippet is the content around the first match with matches wrapped in <mark>
+func (doc *document) snippet(positions []int) string {
+
+	matched := make(map[int]bool)
+	first := -1
+	for _, pos := range positions {
+		i := pos - doc.titleLen - 1
+		if i < 0 {
+			continue
+		}
+		matched[i] = true
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	if len(doc.tokens) == 0 {
+		return ""
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	from := max(first-snippetWords/2, 0)
+	to := min(from+snippetWords, len(doc.tokens))
+
+	sb := strings.Builder{}
+	if from > 0 {
+		sb.WriteString("…")
+	}
+	last := doc.tokens[from].start
+	for i := from; i < to; i++ {
+		tok := doc.tokens[i]
+		sb.WriteString(html.EscapeString(doc.content[last:tok.start]))
+		word := html.EscapeString(doc.content[tok.start:tok.end])
+		if matched[i] {
+			sb.WriteString("<mark>" + word + "</mark>")
+		} else {
+			sb.WriteString(word)
+		}
+		last = tok.end
+	}
+	if to < len(doc.tokens) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaker/anachrome-be/mocks"
+	"github.com/zaker/anachrome-be/stores/blog"
+)
+
+func newTestIndex(t *testing.T, posts map[string]blog.BlogPost) (*Index, *mocks.MockBlogStore) {
+	t.Helper()
+	mbs := &mocks.MockBlogStore{
+		GetBlogPostsMetaFunc: func(ctx context.Context) ([]blog.BlogPostMeta, error) {
+			metas := make([]blog.BlogPostMeta, 0)
+			for _, id := range []string{"go", "rust", "cooking"} {
+				if post, ok := posts[id]; ok {
+					metas = append(metas, post.Meta)
+				}
+			}
+			return metas, nil
+		},
+		GetBlogPostFunc: func(ctx context.Context, id string) (blog.BlogPost, error) {
+			post, ok := posts[id]
+			if !ok {
+				return blog.BlogPost{}, fmt.Errorf("no post %s", id)
+			}
+			return post, nil
+		},
+	}
+	idx := NewIndex(mbs)
+	err := idx.Rebuild(context.Background())
+	if err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+	return idx, mbs
+}
+
+func ids(results []Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.Meta.ID)
+	}
+	return ids
+}
+
+func TestIndex_Search(t *testing.T) {
+
+	idx, _ := newTestIndex(t, map[string]blog.BlogPost{
+		"go": {
+			Meta:    blog.BlogPostMeta{ID: "go", Title: "Programming in Go"},
+			Content: "Go programs are compiled. Running a program is fast.",
+		},
+		"rust": {
+			Meta:    blog.BlogPostMeta{ID: "rust", Title: "Rust notes"},
+			Content: "The borrow checker makes programming in Rust different from Go.",
+		},
+		"cooking": {
+			Meta:    blog.BlogPostMeta{ID: "cooking", Title: "Cooking"},
+			Content: "A recipe for fast <pasta> & sauce.",
+		},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"Empty query", "  ", []string{}},
+		{"Single term ranks title first", "go", []string{"go", "rust"}},
+		{"Stemmed terms", "programs", []string{"go", "rust"}},
+		{"Every term must match", "fast recipe", []string{"cooking"}},
+		{"Phrase", `"programming in rust"`, []string{"rust"}},
+		{"Phrase in title", `"programming in go"`, []string{"go"}},
+		{"Phrase does not span title and content", `"cooking a recipe"`, []string{}},
+		{"Prefix", "borr*", []string{"rust"}},
+		{"Prefix is an inflected word", "running*", []string{"go"}},
+		{"No match", "python", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ids(idx.Search(tt.query, 10)))
+		})
+	}
+
+	assert.Len(t, idx.Search("go", 1), 1)
+}
+
+func TestIndex_Snippet(t *testing.T) {
+
+	idx, _ := newTestIndex(t, map[string]blog.BlogPost{
+		"cooking": {
+			Meta:    blog.BlogPostMeta{ID: "cooking", Title: "Cooking"},
+			Content: "One two three four five six seven eight nine ten a recipe for fast <pasta> & sauce, and more words to fill up the snippet.",
+		},
+	})
+
+	results := idx.Search("pasta", 10)
+	assert.Equal(t, []string{"cooking"}, ids(results))
+	assert.Equal(t,
+		"…nine ten a recipe for fast &lt;<mark>pasta</mark>&gt; &amp; sauce, and more words to…",
+		results[0].Snippet)
+}
+
+func TestIndex_Invalidate(t *testing.T) {
+
+	posts := map[string]blog.BlogPost{
+		"go": {Meta: blog.BlogPostMeta{ID: "go", Title: "Go"}, Content: "Gophers"},
+	}
+	idx, _ := newTestIndex(t, posts)
+	assert.Equal(t, []string{"go"}, ids(idx.Search("gopher", 10)))
+
+	posts["go"] = blog.BlogPost{Meta: blog.BlogPostMeta{ID: "go", Title: "Go"}, Content: "Channels"}
+	posts["rust"] = blog.BlogPost{Meta: blog.BlogPostMeta{ID: "rust", Title: "Rust"}, Content: "Crabs and channels"}
+	assert.NoError(t, idx.Invalidate(context.Background(), "go"))
+	assert.NoError(t, idx.Invalidate(context.Background(), "rust"))
+	assert.Equal(t, []string{}, ids(idx.Search("gopher", 10)))
+	assert.Equal(t, []string{"go", "rust"}, ids(idx.Search("channel", 10)))
+
+	delete(posts, "go")
+	assert.NoError(t, idx.Invalidate(context.Background(), "go"))
+	assert.Equal(t, []string{"rust"}, ids(idx.Search("channel", 10)))
+}
+
+func TestIndex_Rebuild(t *testing.T) {
+
+	posts := map[string]blog.BlogPost{
+		"go":   {Meta: blog.BlogPostMeta{ID: "go", Title: "Go"}, Content: "Channels"},
+		"rust": {Meta: blog.BlogPostMeta{ID: "rust", Title: "Rust"}, Content: "Crabs and channels"},
+	}
+	idx, _ := newTestIndex(t, posts)
+	assert.Equal(t, []string{"go", "rust"}, ids(idx.Search("channel", 10)))
+
+	delete(posts, "go")
+	assert.NoError(t, idx.Rebuild(context.Background()))
+	assert.Equal(t, []string{"rust"}, ids(idx.Search("channel", 10)))
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"strings"
+)
+
+// clause is one required part of a query, a stemmed term, a prefix or a phrase.
+// A prefix clause holds the word and its stem, as terms are indexed stemmed.
+type clause struct {
+	terms  []string
+	prefix bool
+}
+
+// parseQuery splits a query into clauses, "quoted words" are phrases and
+// words ending in * match every term starting with the word
+func parseQuery(query string) []clause {
+
+	clauses := make([]clause, 0)
+	for i, part := range strings.Split(query, `"`) {
+		inPhrase := i%2 == 1
+		if inPhrase {
+			terms := make([]string, 0)
+			for _, tok := range tokenize(part) {
+				terms = append(terms, stem(tok.term))
+			}
+			if len(terms) > 0 {
+				clauses = append(clauses, clause{terms: terms})
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			prefix := strings.HasSuffix(word, "*")
+			toks := tokenize(word)
+			for j, tok := range toks {
+				if prefix && j == len(toks)-1 {
+					clauses = append(clauses, clause{terms: []string{tok.term, stem(tok.term)}, prefix: true})
+					continue
+				}
+				clauses = append(clauses, clause{terms: []string{stem(tok.term)}})
+			}
+		}
+	}
+	return clauses
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kljensen/snowball/english"
+)
+
+type token struct {
+	term  string
+	start int
+	end   int
+}
+
+// tokenize splits text into lower cased words with their byte offsets
+func tokenize(text string) []token {
+
+	tokens := make([]token, 0)
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// stem reduces an english word to its stem
+func stem(word string) string {
+	if utf8.RuneCountInString(word) < 3 {
+		return word
+	}
+	return english.Stem(word, true)
+}